@@ -6,31 +6,120 @@ import (
 	"flag"
 	"fmt"
 	"go-test-task/internal/controller/queue"
+	"go-test-task/internal/controller/resp"
+	"go-test-task/internal/controller/socket"
+	"go-test-task/internal/controller/system"
+	"go-test-task/internal/controller/topic"
 	"go-test-task/internal/domain/model"
 	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/infrastructure/file"
 	"go-test-task/internal/infrastructure/memory"
+	"go-test-task/internal/infrastructure/metrics"
 	"go-test-task/internal/transport"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
+const (
+	storageMemory = "memory"
+	storageFile   = "file"
+)
+
+var (
+	errUnknownStorage              = errors.New("unknown storage")
+	errUnknownQueueType            = errors.New("unknown queue type")
+	errUnknownFullSubscriberPolicy = errors.New("unknown full subscriber policy")
+	errUnknownOverflowPolicy       = errors.New("unknown overflow policy")
+)
+
+type config struct {
+	maxQueues          int
+	autoCreateQueues   bool
+	queueType          string
+	maxMessages        int
+	maxQueueBytes      int
+	maxTotalBytes      int
+	maxMessageSize     int
+	overflowPolicy     string
+	blockTimeout       int
+	defaultWaitTimeout int
+	visibilityTimeout  int
+	retention          int
+	sweepInterval      int
+	idleQueueTimeout   int
+	keepIdleQueues     string
+	maxDeliveries      int
+	deadLetterSuffix   string
+	fullSubscriber     string
+	storage            string
+	dataDir            string
+	fsync              string
+	fsyncInterval      int
+	segmentSize        int
+}
+
 func main() {
+	var cfg config
+
 	port := flag.Int("port", 8080, "HTTP port")
-	maxQueues := flag.Int("max-queues", 0, "max number of queues")
-	maxMessages := flag.Int("max-messages", 0, "max messages in queue")
-	defaultWaitTimeout := flag.Int("wait-timeout", 86400, "default timeout (sec)")
+	respPort := flag.Int("resp-port", 0, "port of the Redis protocol listener, 0 disables")
+	drainDelay := flag.Int("drain-delay", 0, "time the server keeps serving with failing readiness before shutdown (sec)")
+	flag.IntVar(&cfg.maxQueues, "max-queues", 0, "max number of queues")
+	flag.BoolVar(&cfg.autoCreateQueues, "auto-create-queues", true, "create missing queues on put and subscribe, otherwise only PUT /queue/{name}/config does")
+	flag.StringVar(&cfg.queueType, "queue-type", string(model.QueueTypeFIFO), "queue type: fifo or priority")
+	flag.IntVar(&cfg.maxMessages, "max-messages", 0, "max messages in queue")
+	flag.IntVar(&cfg.maxQueueBytes, "max-queue-bytes", 0, "max size of messages in queue, 0 disables (bytes)")
+	flag.IntVar(&cfg.maxTotalBytes, "max-total-bytes", 0, "max size of messages in all queues, 0 disables (bytes)")
+	flag.IntVar(&cfg.maxMessageSize, "max-message-size", 0, "max size of message content and attributes, 0 disables (bytes)")
+	flag.StringVar(&cfg.overflowPolicy, "overflow-policy", string(model.OverflowReject), "put to a full queue: reject, drop-oldest, drop-newest or block")
+	flag.IntVar(&cfg.blockTimeout, "block-timeout", 30, "time a put waits for room with the block overflow policy (sec)")
+	flag.IntVar(&cfg.defaultWaitTimeout, "wait-timeout", 86400, "default timeout (sec)")
+	flag.IntVar(&cfg.visibilityTimeout, "visibility-timeout", 0, "default visibility timeout of reserved messages, 0 pops them (sec)")
+	flag.IntVar(&cfg.retention, "retention", 0, "default message retention, 0 keeps messages until consumed (sec)")
+	flag.IntVar(&cfg.sweepInterval, "sweep-interval", 1, "interval of deleting expired messages, 0 disables (sec)")
+	flag.IntVar(&cfg.idleQueueTimeout, "idle-queue-timeout", 0, "delete queues that stayed empty and without consumers that long, 0 disables (sec)")
+	flag.StringVar(&cfg.keepIdleQueues, "keep-idle-queues", "", "comma-separated glob patterns of queue names never deleted as idle")
+	flag.IntVar(&cfg.maxDeliveries, "max-deliveries", 0, "deliveries of a reserved message before it goes to the dead-letter queue, 0 disables")
+	flag.StringVar(&cfg.deadLetterSuffix, "dead-letter-suffix", ".dlq", "dead-letter queue name suffix")
+	flag.StringVar(&cfg.fullSubscriber, "full-subscriber-policy", string(model.FullSubscriberReject), "topic publish to a full subscriber queue: reject or skip")
+	flag.StringVar(&cfg.storage, "storage", storageMemory, "message storage: memory or file")
+	flag.StringVar(&cfg.dataDir, "data-dir", "data", "directory of the file storage log")
+	flag.StringVar(&cfg.fsync, "fsync", string(file.SyncInterval), "file storage fsync policy: always, interval or never")
+	flag.IntVar(&cfg.fsyncInterval, "fsync-interval", 1000, "file storage fsync interval (ms)")
+	flag.IntVar(&cfg.segmentSize, "segment-size", 64<<20, "file storage log segment size (bytes)")
 	flag.Parse()
 
+	handlers, shutdown, err := getHandlers(cfg)
+	if err != nil {
+		log.Fatalf("server setup error: %v", err)
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	srv := setupServer(*port, *maxQueues, *maxMessages, *defaultWaitTimeout)
+	srv := setupServer(*port, handlers.http)
+
+	if *respPort > 0 {
+		setupRespServer(*respPort, handlers.resp)
+	}
 
 	<-sigCh
+	log.Println("Draining server...")
+
+	if err := shutdown.drain(); err != nil {
+		log.Println("server Drain error:", err)
+	}
+
+	// Load balancers get time to see the failing readiness and stop sending requests
+	time.Sleep(time.Duration(*drainDelay) * time.Second)
 	log.Println("Shutting down server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -39,14 +128,22 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Println("server Shutdown error:", err)
 	}
+
+	if err := handlers.resp.Close(); err != nil {
+		log.Println("RESP server Close error:", err)
+	}
+
+	if err := shutdown.close(); err != nil {
+		log.Println("storage Close error:", err)
+	}
 }
 
-func setupServer(port, maxQueues, maxMessages, defaultWaitTimeout int) *http.Server {
+func setupServer(port int, handler http.Handler) *http.Server {
 	addr := fmt.Sprintf(":%d", port)
 
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: getHttpHandler(maxQueues, maxMessages, defaultWaitTimeout),
+		Handler: handler,
 	}
 
 	go func() {
@@ -59,19 +156,256 @@ func setupServer(port, maxQueues, maxMessages, defaultWaitTimeout int) *http.Ser
 	return srv
 }
 
-func getHttpHandler(maxQueues, maxMessages, defaultWaitTimeout int) http.Handler {
+func setupRespServer(port int, respServer *transport.Resp) {
+	addr := fmt.Sprintf(":%d", port)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("RESP server Listen error: %v", err)
+	}
+
+	go func() {
+		log.Println("Listening to RESP on", addr)
+		if err := respServer.Serve(listener); err != nil {
+			log.Fatalf("RESP server Serve error: %v", err)
+		}
+	}()
+}
+
+// handlers serve the same broker over HTTP and the Redis protocol.
+type handlers struct {
+	http http.Handler
+	resp *transport.Resp
+}
+
+// shutdown stops the server built by getHandlers.
+type shutdown struct {
+	// drain fails readiness, wakes waiting consumers, rejects new puts and flushes the storage
+	drain func() error
+	// close stops background jobs and closes the storage
+	close func() error
+}
+
+func getHandlers(cfg config) (handlers, shutdown, error) {
+	if !model.QueueType(cfg.queueType).IsValid() {
+		return handlers{}, shutdown{}, fmt.Errorf("%w: %q", errUnknownQueueType, cfg.queueType)
+	}
+
+	if !model.OverflowPolicy(cfg.overflowPolicy).IsValid() {
+		return handlers{}, shutdown{}, fmt.Errorf("%w: %q", errUnknownOverflowPolicy, cfg.overflowPolicy)
+	}
+
+	if err := defaultQueueConfig(cfg)("").Validate(); err != nil {
+		return handlers{}, shutdown{}, err
+	}
+
+	if !model.FullSubscriberPolicy(cfg.fullSubscriber).IsValid() {
+		return handlers{}, shutdown{}, fmt.Errorf("%w: %q", errUnknownFullSubscriberPolicy, cfg.fullSubscriber)
+	}
+
+	for _, pattern := range strings.Split(cfg.keepIdleQueues, ",") {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return handlers{}, shutdown{}, fmt.Errorf("keep-idle-queues %q: %w", pattern, err)
+		}
+	}
+
+	repos, err := getStorage(cfg)
+	if err != nil {
+		return handlers{}, shutdown{}, err
+	}
+
+	queueRepo := repos.queue
+
 	waiter := model.NewWaiter()
-	queueRepo := memory.NewInMemoryQueue(maxQueues, maxMessages)
-	brokerRepo := memory.NewInMemoryBroker(maxQueues, func(name string) *model.Queue {
-		return model.NewQueue(name, maxMessages, queueRepo)
-	})
+	scheduler := model.NewScheduler(queueRepo, waiter)
+	broker := model.NewBroker(model.BrokerConfig{
+		MaxQueues:          cfg.maxQueues,
+		MaxBytes:           cfg.maxTotalBytes,
+		AutoCreate:         cfg.autoCreateQueues,
+		DefaultQueueConfig: defaultQueueConfig(cfg),
+	}, repos.broker)
+	registry := metrics.NewRegistry()
+	brokerMetrics := metrics.NewBrokerMetrics(registry)
+	putter := usecase.NewMessagePutter(broker, waiter, scheduler, brokerMetrics)
+	getter := usecase.NewMessageGetter(broker, waiter, brokerMetrics)
+	acker := usecase.NewMessageAcker(broker, waiter)
+	redriver := usecase.NewDeadLetterRedriver(broker, waiter)
+	publisher := usecase.NewTopicPublisher(broker, repos.topic, putter, model.FullSubscriberPolicy(cfg.fullSubscriber))
+	subscriber := usecase.NewTopicSubscriber(broker, repos.topic)
+	manager := usecase.NewQueueManager(broker, waiter, brokerMetrics)
+	drainer := usecase.NewDrainer(broker, waiter)
+
+	putAction := queue.NewPutAction(putter, cfg.maxMessageSize)
+	putBatchAction := queue.NewPutBatchAction(putter, cfg.maxMessageSize)
+	getAction := queue.NewGetAction(getter, time.Duration(cfg.visibilityTimeout)*time.Second)
+	streamAction := queue.NewStreamAction(getter, time.Duration(cfg.visibilityTimeout)*time.Second)
+	ackAction := queue.NewAckAction(acker)
+	nackAction := queue.NewNackAction(acker)
+	redriveAction := queue.NewRedriveAction(redriver)
+	listAction := queue.NewListAction(manager)
+	statsAction := queue.NewStatsAction(manager)
+	purgeAction := queue.NewPurgeAction(manager)
+	deleteAction := queue.NewDeleteAction(manager)
+	configAction := queue.NewConfigAction(manager)
+	getConfigAction := queue.NewGetConfigAction(manager)
+	publishAction := topic.NewPublishAction(publisher, cfg.maxMessageSize)
+	subscribeAction := topic.NewSubscribeAction(subscriber)
+	unsubscribeAction := topic.NewUnsubscribeAction(subscriber)
+	subscriptionsAction := topic.NewSubscriptionsAction(subscriber)
+	socketAction := socket.NewSocketAction(
+		getter, putter, acker, publisher, time.Duration(cfg.visibilityTimeout)*time.Second, cfg.maxMessageSize,
+	)
+	metricsAction := system.NewMetricsAction(manager, brokerMetrics, registry)
+	healthAction := system.NewHealthAction()
+	readyAction := system.NewReadyAction(drainer)
 
-	broker := model.NewBroker(maxQueues, brokerRepo)
-	putter := usecase.NewMessagePutter(broker, waiter)
-	getter := usecase.NewMessageGetter(broker, waiter)
+	ctx, cancel := context.WithCancel(context.Background())
 
-	putAction := queue.NewPutAction(putter)
-	getAction := queue.NewGetAction(getter, time.Duration(defaultWaitTimeout)*time.Second)
+	var jobs sync.WaitGroup
+
+	runJob := func(job func()) {
+		jobs.Add(1)
+
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+
+	runJob(func() { scheduler.Run(ctx) })
+
+	if cfg.sweepInterval > 0 {
+		runJob(func() {
+			usecase.NewExpiredMessageSweeper(broker, queueRepo).Run(ctx, time.Duration(cfg.sweepInterval)*time.Second)
+		})
+	}
+
+	if cfg.idleQueueTimeout > 0 {
+		runJob(func() {
+			usecase.NewIdleQueueReaper(manager, time.Duration(cfg.idleQueueTimeout)*time.Second).Run(ctx)
+		})
+	}
+
+	drain := func() error {
+		if err := drainer.Drain(); err != nil {
+			return err
+		}
+
+		return repos.flush()
+	}
+
+	closeAll := func() error {
+		cancel()
+		jobs.Wait()
+
+		return repos.close()
+	}
+
+	httpHandler := transport.NewHttp(
+		putAction, putBatchAction, getAction, streamAction, ackAction, nackAction, redriveAction,
+		listAction, statsAction, purgeAction, deleteAction, configAction, getConfigAction,
+		publishAction, subscribeAction, unsubscribeAction, subscriptionsAction, socketAction,
+		metricsAction, healthAction, readyAction,
+	).Use(metrics.HttpMiddleware(registry), transport.Recover)
+
+	respServer := transport.NewResp(
+		int64(cfg.maxMessageSize),
+		resp.NewPushCommand("LPUSH", putter, manager), resp.NewPushCommand("RPUSH", putter, manager),
+		resp.NewPopCommand(getter), resp.NewBlockingPopCommand(getter),
+		resp.NewLenCommand(manager), resp.NewDelCommand(manager), resp.NewPingCommand(),
+	)
+
+	return handlers{http: httpHandler, resp: respServer}, shutdown{drain: drain, close: closeAll}, nil
+}
+
+type repositories struct {
+	broker model.BrokerStorage
+	queue  model.QueueStorage
+	topic  model.TopicStorage
+	flush  func() error
+	close  func() error
+}
+
+func getStorage(cfg config) (repositories, error) {
+	queueRepo := memory.NewInMemoryQueue(cfg.maxQueues)
+	topicRepo := memory.NewInMemoryTopic()
+
+	switch cfg.storage {
+	case storageMemory:
+		return repositories{
+			broker: memory.NewInMemoryBroker(cfg.maxQueues, queueRepo),
+			queue:  queueRepo,
+			topic:  topicRepo,
+			flush:  func() error { return nil },
+			close:  func() error { return nil },
+		}, nil
+	case storageFile:
+		wal, err := file.OpenLog(cfg.dataDir, file.Options{
+			SegmentSize:  int64(cfg.segmentSize),
+			Sync:         file.SyncPolicy(cfg.fsync),
+			SyncInterval: time.Duration(cfg.fsyncInterval) * time.Millisecond,
+		})
+		if err != nil {
+			return repositories{}, err
+		}
+
+		fileQueueRepo, err := file.NewFileQueue(wal, queueRepo)
+		if err != nil {
+			wal.Close()
+
+			return repositories{}, err
+		}
+
+		brokerRepo, err := file.NewFileBroker(wal, memory.NewInMemoryBroker(cfg.maxQueues, fileQueueRepo), defaultQueueConfig(cfg))
+		if err != nil {
+			wal.Close()
+
+			return repositories{}, err
+		}
+
+		fileTopicRepo, err := file.NewFileTopic(wal, topicRepo)
+		if err != nil {
+			wal.Close()
+
+			return repositories{}, err
+		}
+
+		return repositories{broker: brokerRepo, queue: fileQueueRepo, topic: fileTopicRepo, flush: wal.Sync, close: wal.Close}, nil
+	default:
+		return repositories{}, fmt.Errorf("%w: %q", errUnknownStorage, cfg.storage)
+	}
+}
+
+// defaultQueueConfig returns the config of queues created without one, taken from the flags.
+func defaultQueueConfig(cfg config) func(name string) model.QueueConfig {
+	return func(name string) model.QueueConfig {
+		var deadLetterPolicy model.DeadLetterPolicy
+		if cfg.maxDeliveries > 0 && !strings.HasSuffix(name, cfg.deadLetterSuffix) {
+			deadLetterPolicy = model.DeadLetterPolicy{MaxDeliveries: cfg.maxDeliveries, QueueName: name + cfg.deadLetterSuffix}
+		}
+
+		return model.QueueConfig{
+			Type:             model.QueueType(cfg.queueType),
+			MaxMessages:      cfg.maxMessages,
+			MaxBytes:         cfg.maxQueueBytes,
+			MaxMessageSize:   cfg.maxMessageSize,
+			WaitTimeout:      time.Duration(cfg.defaultWaitTimeout) * time.Second,
+			Retention:        time.Duration(cfg.retention) * time.Second,
+			OverflowPolicy:   model.OverflowPolicy(cfg.overflowPolicy),
+			BlockTimeout:     time.Duration(cfg.blockTimeout) * time.Second,
+			DeadLetterPolicy: deadLetterPolicy,
+			KeepIdle:         isKeptIdle(cfg, name),
+		}
+	}
+}
+
+// isKeptIdle matches the queue name against glob patterns of -keep-idle-queues.
+func isKeptIdle(cfg config, queueName string) bool {
+	for _, pattern := range strings.Split(cfg.keepIdleQueues, ",") {
+		if isMatched, _ := path.Match(strings.TrimSpace(pattern), queueName); isMatched {
+			return true
+		}
+	}
 
-	return transport.NewHttp(putAction, getAction)
+	return false
 }
@@ -1,23 +1,55 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go-test-task/internal/domain/model"
 	"go-test-task/internal/domain/valueobject"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
+func testConfig() config {
+	return config{
+		storage:            storageMemory,
+		autoCreateQueues:   true,
+		queueType:          string(model.QueueTypeFIFO),
+		fullSubscriber:     string(model.FullSubscriberReject),
+		maxQueues:          10,
+		maxMessages:        10,
+		overflowPolicy:     string(model.OverflowReject),
+		defaultWaitTimeout: 10,
+	}
+}
+
+func newHttpHandler(t *testing.T, cfg config) http.Handler {
+	t.Helper()
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { shutdown.close() })
+
+	return handlers.http
+}
+
 func Test_Put_Then_Get_Message(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 10, 10)
+	httpHandler := newHttpHandler(t, testConfig())
 
 	// 1. PUT message
 	msg := valueobject.Message{Content: "test message"}
@@ -44,7 +76,7 @@ func Test_Put_Then_Get_Message(t *testing.T) {
 func Test_Get_Waiters_ReceiveMessagesInOrder(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 10, 10)
+	httpHandler := newHttpHandler(t, testConfig())
 
 	// 1. make empty queue
 	msg := valueobject.Message{Content: "test message"}
@@ -103,7 +135,7 @@ func Test_Get_Waiters_ReceiveMessagesInOrder(t *testing.T) {
 func Test_Get_EmptyQueue_TimesOut(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 10, 10)
+	httpHandler := newHttpHandler(t, testConfig())
 
 	// 1. PUT message
 	msg := valueobject.Message{Content: "test message"}
@@ -135,7 +167,7 @@ func Test_Get_EmptyQueue_TimesOut(t *testing.T) {
 func Test_Put_InvalidMessage(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 10, 10)
+	httpHandler := newHttpHandler(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodPut, "/queue/test", bytes.NewReader([]byte(`{}`)))
 	resp := httptest.NewRecorder()
@@ -147,7 +179,7 @@ func Test_Put_InvalidMessage(t *testing.T) {
 func Test_Get_MissingQueueName(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 10, 10)
+	httpHandler := newHttpHandler(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/queue/", nil)
 	resp := httptest.NewRecorder()
@@ -159,7 +191,9 @@ func Test_Get_MissingQueueName(t *testing.T) {
 func Test_Broker_IsFull(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(1, 10, 10)
+	cfg := testConfig()
+	cfg.maxQueues = 1
+	httpHandler := newHttpHandler(t, cfg)
 
 	msg := valueobject.Message{Content: "message A"}
 	body, _ := json.Marshal(msg)
@@ -179,7 +213,9 @@ func Test_Broker_IsFull(t *testing.T) {
 func Test_Queue_IsFull(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 1, 10)
+	cfg := testConfig()
+	cfg.maxMessages = 1
+	httpHandler := newHttpHandler(t, cfg)
 
 	msg := valueobject.Message{Content: "first"}
 	body1, _ := json.Marshal(msg)
@@ -201,7 +237,7 @@ func Test_Queue_IsFull(t *testing.T) {
 func Test_Close_Request(t *testing.T) {
 	t.Parallel()
 
-	httpHandler := getHttpHandler(10, 10, 10)
+	httpHandler := newHttpHandler(t, testConfig())
 
 	// 1. make empty queue
 	msg1 := valueobject.Message{Content: "test message"}
@@ -258,3 +294,2169 @@ func Test_Close_Request(t *testing.T) {
 
 	assert.Equal(t, "test message 2", msg.Content)
 }
+
+func Test_FileStorage_RestoresMessagesAfterRestart(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "always"
+	cfg.segmentSize = 256
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	for i := range 5 {
+		assert.Equal(t, http.StatusOK, putMessage(httpHandler, "durable", fmt.Sprintf("msg-%d", i)).Code)
+	}
+
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "empty", "gone").Code)
+	assert.Equal(t, "msg-0", getMessage(t, httpHandler, "/queue/durable").Content)
+	assert.Equal(t, "gone", getMessage(t, httpHandler, "/queue/empty").Content)
+	require.NoError(t, shutdown.close())
+
+	// Restart on the same data dir
+	httpHandler = newHttpHandler(t, cfg)
+
+	for i := 1; i < 5; i++ {
+		assert.Equal(t, fmt.Sprintf("msg-%d", i), getMessage(t, httpHandler, "/queue/durable").Content)
+	}
+
+	// Queue survives restart even when empty
+	req := httptest.NewRequest(http.MethodGet, "/queue/empty?timeout=0", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Contains(t, resp.Body.String(), "wait timeout")
+}
+
+func Test_FileStorage_RecoversFromTornWrite(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "torn", "kept").Code)
+	require.NoError(t, shutdown.close())
+
+	// Simulate a crash in the middle of appending a record
+	segments, err := filepath.Glob(filepath.Join(cfg.dataDir, "*.log"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{42, 0, 0, 0, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	httpHandler = newHttpHandler(t, cfg)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "torn", "after crash").Code)
+	assert.Equal(t, "kept", getMessage(t, httpHandler, "/queue/torn").Content)
+	assert.Equal(t, "after crash", getMessage(t, httpHandler, "/queue/torn").Content)
+}
+
+func putMessage(httpHandler http.Handler, queueName, content string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(valueobject.Message{Content: content})
+	req := httptest.NewRequest(http.MethodPut, "/queue/"+queueName, bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func getMessage(t *testing.T, httpHandler http.Handler, target string) valueobject.Message {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var msg valueobject.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+
+	return msg
+}
+
+func Test_Get_WithVisibilityTimeout_AckRemovesMessage(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "acked", "first").Code)
+
+	receipt := reserveMessage(t, httpHandler, "/queue/acked?visibility_timeout=1", "first")
+
+	// Reserved message is invisible
+	req := httptest.NewRequest(http.MethodGet, "/queue/acked?timeout=0", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "acked", "ack", receipt).Code)
+	assert.Equal(t, http.StatusNotFound, postReceipt(httpHandler, "acked", "ack", receipt).Code)
+
+	// Acked message does not come back after the visibility timeout
+	req = httptest.NewRequest(http.MethodGet, "/queue/acked?timeout=2", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func Test_Get_WithVisibilityTimeout_ExpiredMessageReappearsInOrder(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "expiring", "first").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "expiring", "second").Code)
+
+	receipt := reserveMessage(t, httpHandler, "/queue/expiring?visibility_timeout=1", "first")
+	assert.Equal(t, "second", getMessage(t, httpHandler, "/queue/expiring").Content)
+
+	// Long-polling waiter gets the message once it is visible again
+	start := time.Now()
+	assert.Equal(t, "first", getMessage(t, httpHandler, "/queue/expiring?timeout=5").Content)
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+
+	assert.Equal(t, http.StatusNotFound, postReceipt(httpHandler, "expiring", "ack", receipt).Code)
+}
+
+func Test_Nack_RedeliversMessageAtItsPosition(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "nacked", "first").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "nacked", "second").Code)
+
+	receipt := reserveMessage(t, httpHandler, "/queue/nacked?visibility_timeout=60", "first")
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "nacked", "nack", receipt).Code)
+	assert.Equal(t, http.StatusNotFound, postReceipt(httpHandler, "nacked", "nack", receipt).Code)
+
+	assert.Equal(t, "first", getMessage(t, httpHandler, "/queue/nacked").Content)
+	assert.Equal(t, "second", getMessage(t, httpHandler, "/queue/nacked").Content)
+	assert.Equal(t, http.StatusNotFound, postReceipt(httpHandler, "missing", "nack", receipt).Code)
+}
+
+func Test_FileStorage_RestoresUnackedMessagesAfterRestart(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "always"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "unacked", "lost consumer").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "unacked", "acked").Code)
+	reserveMessage(t, httpHandler, "/queue/unacked?visibility_timeout=60", "lost consumer")
+	receipt := reserveMessage(t, httpHandler, "/queue/unacked?visibility_timeout=60", "acked")
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "unacked", "ack", receipt).Code)
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+	assert.Equal(t, "lost consumer", getMessage(t, httpHandler, "/queue/unacked").Content)
+
+	req := httptest.NewRequest(http.MethodGet, "/queue/unacked?timeout=0", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func reserveMessage(t *testing.T, httpHandler http.Handler, target, expectedContent string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var result struct {
+		Message string `json:"message"`
+		Receipt string `json:"receipt"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, expectedContent, result.Message)
+	require.NotEmpty(t, result.Receipt)
+
+	return result.Receipt
+}
+
+func postReceipt(httpHandler http.Handler, queueName, action, receipt string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/queue/"+queueName+"/"+action+"/"+receipt, nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func Test_DeadLetterQueue_TakesExhaustedMessageAndRedrivesIt(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxDeliveries = 2
+	cfg.deadLetterSuffix = ".dlq"
+	httpHandler := newHttpHandler(t, cfg)
+
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "poison").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "healthy").Code)
+
+	receipt := reserveMessage(t, httpHandler, "/queue/jobs?visibility_timeout=60", "poison")
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "jobs", "nack", receipt).Code)
+
+	receipt = reserveMessage(t, httpHandler, "/queue/jobs?visibility_timeout=60", "poison")
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "jobs", "nack", receipt).Code)
+
+	// Exhausted message skips the source queue
+	assert.Equal(t, "healthy", getMessage(t, httpHandler, "/queue/jobs").Content)
+	assert.Equal(t, "poison", getMessage(t, httpHandler, "/queue/jobs.dlq?visibility_timeout=60").Content)
+
+	req := httptest.NewRequest(http.MethodPost, "/queue/jobs/redrive", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"moved": 0}`, resp.Body.String(), "reserved dead letter is not redriven")
+
+	req = httptest.NewRequest(http.MethodPost, "/queue/jobs.dlq/redrive", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func Test_DeadLetterQueue_ExpiredMessageIsRedriven(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxDeliveries = 1
+	cfg.deadLetterSuffix = ".dlq"
+	httpHandler := newHttpHandler(t, cfg)
+
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "tasks", "slow").Code)
+	reserveMessage(t, httpHandler, "/queue/tasks?visibility_timeout=1", "slow")
+
+	// Dead-letter queue is created with the first dead letter
+	time.Sleep(1500 * time.Millisecond)
+
+	msg := getMessage(t, httpHandler, "/queue/tasks.dlq")
+	assert.Equal(t, "slow", msg.Content)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "tasks.dlq", msg.Content).Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/queue/tasks/redrive?max=10", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"moved": 1}`, resp.Body.String())
+
+	msg = getMessage(t, httpHandler, "/queue/tasks")
+	assert.Equal(t, "slow", msg.Content)
+	assert.Equal(t, 1, msg.Deliveries)
+}
+
+func Test_DeadLetterQueue_RedriveStopsAtByteBudget(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxDeliveries = 1
+	cfg.deadLetterSuffix = ".dlq"
+	httpHandler := newHttpHandler(t, cfg)
+
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "budget", `{"max_bytes": 6}`).Code)
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "budget.dlq", "aaaa", "bbbb").Code)
+
+	resp := doRequest(httpHandler, http.MethodPost, "/queue/budget/redrive")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"moved": 1}`, resp.Body.String())
+
+	assert.Equal(t, "aaaa", getMessage(t, httpHandler, "/queue/budget").Content)
+	assert.Equal(t, "bbbb", getMessage(t, httpHandler, "/queue/budget.dlq").Content, "the rest stays dead-lettered")
+}
+
+func Test_DeadLetterQueue_RedriveIgnoresDropPolicies(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxDeliveries = 1
+	cfg.deadLetterSuffix = ".dlq"
+	httpHandler := newHttpHandler(t, cfg)
+
+	for _, policy := range []string{"drop-newest", "drop-oldest"} {
+		require.Equal(t, http.StatusOK, putConfig(httpHandler, policy, `{"max_messages": 1, "overflow_policy": "`+policy+`"}`).Code)
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, policy, "live").Code)
+		require.Equal(t, http.StatusOK, putBatch(httpHandler, policy+".dlq", "a", "b").Code)
+
+		resp := doRequest(httpHandler, http.MethodPost, "/queue/"+policy+"/redrive")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"moved": 0}`, resp.Body.String(), policy)
+
+		assert.Equal(t, []string{"live"}, contentsOf(getBatch(t, httpHandler, "/queue/"+policy+"?max=10")), policy)
+		assert.Equal(t, []string{"a", "b"}, contentsOf(getBatch(t, httpHandler, "/queue/"+policy+".dlq?max=10")), policy)
+	}
+}
+
+func Test_Message_HasServerAssignedMetadata(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	body := []byte(`{"message": "traced", "attributes": {"trace-id": "abc", "kind": "job"}, "id": "client-id"}`)
+	req := httptest.NewRequest(http.MethodPut, "/queue/traced", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Body.String())
+
+	messageID := resp.Header().Get("X-Message-Id")
+	require.NotEmpty(t, messageID)
+	assert.NotEqual(t, "client-id", messageID)
+	assert.NotEqual(t, messageID, putMessage(httpHandler, "traced", "second").Header().Get("X-Message-Id"))
+
+	req = httptest.NewRequest(http.MethodGet, "/queue/traced", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, messageID, resp.Header().Get("X-Message-Id"))
+
+	enqueuedAt, err := time.Parse(time.RFC3339Nano, resp.Header().Get("X-Message-Enqueued-At"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), enqueuedAt, 5*time.Second)
+
+	var msg valueobject.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+	assert.Equal(t, messageID, msg.ID)
+	assert.Equal(t, "traced", msg.Content)
+	assert.Equal(t, map[string]string{"trace-id": "abc", "kind": "job"}, msg.Attributes)
+	assert.True(t, enqueuedAt.Equal(msg.EnqueuedAt))
+}
+
+func Test_Put_InvalidAttributes(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	for _, body := range []string{`{"message": "x", "attributes": {"": "empty key"}}`, `{"message": "x", "attributes": {"n": 1}}`} {
+		req := httptest.NewRequest(http.MethodPut, "/queue/test", bytes.NewReader([]byte(body)))
+		resp := httptest.NewRecorder()
+		httpHandler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+	}
+}
+
+func Test_Put_WithTTL_ExpiredMessageIsSkipped(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	req := httptest.NewRequest(http.MethodPut, "/queue/ttl?ttl=1", bytes.NewReader([]byte(`{"message": "short"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/queue/ttl?ttl=1h", bytes.NewReader([]byte(`{"message": "long"}`)))
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	msg := getMessage(t, httpHandler, "/queue/ttl")
+	assert.Equal(t, "long", msg.Content)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), msg.ExpiresAt, 5*time.Second)
+
+	for _, ttl := range []string{"0", "-1", "soon"} {
+		req = httptest.NewRequest(http.MethodPut, "/queue/ttl?ttl="+ttl, bytes.NewReader([]byte(`{"message": "x"}`)))
+		resp = httptest.NewRecorder()
+		httpHandler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, ttl)
+	}
+}
+
+func Test_Queue_ExpiredMessagesFreeSpace(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxMessages = 1
+	cfg.retention = 1
+	httpHandler := newHttpHandler(t, cfg)
+
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "retained", "old").Code)
+	assert.Equal(t, http.StatusConflict, putMessage(httpHandler, "retained", "rejected").Code)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "retained", "new").Code)
+	assert.Equal(t, "new", getMessage(t, httpHandler, "/queue/retained").Content)
+}
+
+func Test_FileStorage_SweeperDeletesExpiredMessages(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+	cfg.segmentSize = 256
+	cfg.maxMessages = 0
+	cfg.sweepInterval = 1
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	for i := range 20 {
+		req := httptest.NewRequest(http.MethodPut, "/queue/swept?ttl=1", bytes.NewReader([]byte(fmt.Sprintf(`{"message": "expiring-%d"}`, i))))
+		resp := httptest.NewRecorder()
+		httpHandler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	segments, err := filepath.Glob(filepath.Join(cfg.dataDir, "*.log"))
+	require.NoError(t, err)
+	require.Greater(t, len(segments), 2)
+
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "swept", "kept").Code)
+
+	segments, err = filepath.Glob(filepath.Join(cfg.dataDir, "*.log"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(segments), 2, "segments of expired messages are compacted")
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+	assert.Equal(t, "kept", getMessage(t, httpHandler, "/queue/swept").Content)
+}
+
+func Test_Put_WithDelay_MessageIsDeliveredWhenDue(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	req := httptest.NewRequest(http.MethodPut, "/queue/delayed?delay=1s", bytes.NewReader([]byte(`{"message": "later"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/queue/delayed?timeout=0", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	// Message put later without delay is not held back
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "delayed", "now").Code)
+	assert.Equal(t, "now", getMessage(t, httpHandler, "/queue/delayed").Content)
+
+	// Long-polling waiter is woken by the scheduler
+	start := time.Now()
+	assert.Equal(t, "later", getMessage(t, httpHandler, "/queue/delayed?timeout=5").Content)
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+}
+
+func Test_Put_WithDeliverAt(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	past := url.QueryEscape(time.Now().Add(-time.Minute).Format(time.RFC3339))
+	req := httptest.NewRequest(http.MethodPut, "/queue/scheduled?deliver_at="+past, bytes.NewReader([]byte(`{"message": "overdue"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "overdue", getMessage(t, httpHandler, "/queue/scheduled?timeout=0").Content)
+
+	future := url.QueryEscape(time.Now().Add(2 * time.Second).Format(time.RFC3339))
+	req = httptest.NewRequest(http.MethodPut, "/queue/scheduled?deliver_at="+future, bytes.NewReader([]byte(`{"message": "scheduled"}`)))
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "scheduled", getMessage(t, httpHandler, "/queue/scheduled?timeout=5").Content)
+
+	for _, query := range []string{"delay=-1s", "delay=later", "deliver_at=tomorrow", "delay=1&deliver_at=" + future} {
+		req = httptest.NewRequest(http.MethodPut, "/queue/scheduled?"+query, bytes.NewReader([]byte(`{"message": "x"}`)))
+		resp = httptest.NewRecorder()
+		httpHandler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
+
+func Test_FileStorage_RestoresDelayedMessages(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "always"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	req := httptest.NewRequest(http.MethodPut, "/queue/delayed?delay=1", bytes.NewReader([]byte(`{"message": "survivor"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+
+	req = httptest.NewRequest(http.MethodGet, "/queue/delayed?timeout=0", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	assert.Equal(t, "survivor", getMessage(t, httpHandler, "/queue/delayed?timeout=5").Content)
+}
+
+func putPriorityMessage(t *testing.T, httpHandler http.Handler, queueName, content string, priority int) {
+	t.Helper()
+
+	body, _ := json.Marshal(valueobject.Message{Content: content, Priority: priority})
+	req := httptest.NewRequest(http.MethodPut, "/queue/"+queueName, bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+}
+
+func Test_PriorityQueue_DeliversHighestPriorityFirst(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.queueType = string(model.QueueTypePriority)
+	httpHandler := newHttpHandler(t, cfg)
+
+	putPriorityMessage(t, httpHandler, "prio", "low", 0)
+	putPriorityMessage(t, httpHandler, "prio", "high-1", 5)
+	putPriorityMessage(t, httpHandler, "prio", "negative", -1)
+	putPriorityMessage(t, httpHandler, "prio", "mid", 2)
+	putPriorityMessage(t, httpHandler, "prio", "high-2", 5)
+
+	// Released message returns to the head of its priority
+	receipt := reserveMessage(t, httpHandler, "/queue/prio?visibility_timeout=60", "high-1")
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "prio", "nack", receipt).Code)
+
+	msg := getMessage(t, httpHandler, "/queue/prio")
+	assert.Equal(t, "high-1", msg.Content)
+	assert.Equal(t, 5, msg.Priority)
+
+	for _, expected := range []string{"high-2", "mid", "low", "negative"} {
+		assert.Equal(t, expected, getMessage(t, httpHandler, "/queue/prio").Content)
+	}
+}
+
+func Test_FifoQueue_IgnoresPriority(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	putPriorityMessage(t, httpHandler, "fifo", "first", 0)
+	putPriorityMessage(t, httpHandler, "fifo", "second", 9)
+
+	msg := getMessage(t, httpHandler, "/queue/fifo")
+	assert.Equal(t, "first", msg.Content)
+	assert.Zero(t, msg.Priority)
+	assert.Equal(t, "second", getMessage(t, httpHandler, "/queue/fifo").Content)
+}
+
+func Test_UnknownQueueType(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.queueType = "lifo"
+
+	_, _, err := getHandlers(cfg)
+	assert.ErrorIs(t, err, errUnknownQueueType)
+}
+
+func Test_FileStorage_RestoresPriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.queueType = string(model.QueueTypePriority)
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "always"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	putPriorityMessage(t, httpHandler, "prio", "low", 1)
+	putPriorityMessage(t, httpHandler, "prio", "high", 3)
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+	assert.Equal(t, "high", getMessage(t, httpHandler, "/queue/prio").Content)
+	assert.Equal(t, "low", getMessage(t, httpHandler, "/queue/prio").Content)
+}
+
+func putBatch(httpHandler http.Handler, queueName string, contents ...string) *httptest.ResponseRecorder {
+	messages := make([]valueobject.Message, len(contents))
+	for i, content := range contents {
+		messages[i] = valueobject.Message{Content: content}
+	}
+
+	body, _ := json.Marshal(messages)
+	req := httptest.NewRequest(http.MethodPut, "/queue/"+queueName+"/batch", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func getBatch(t *testing.T, httpHandler http.Handler, target string) []getBatchItem {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var items []getBatchItem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+
+	return items
+}
+
+type getBatchItem struct {
+	valueobject.Message
+	Receipt string `json:"receipt"`
+}
+
+func contentsOf(items []getBatchItem) []string {
+	contents := make([]string, len(items))
+	for i, item := range items {
+		contents[i] = item.Content
+	}
+
+	return contents
+}
+
+func Test_PutBatch_IsAllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxMessages = 3
+	httpHandler := newHttpHandler(t, cfg)
+
+	resp := putBatch(httpHandler, "batched", "a", "b")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var result struct {
+		IDs []string `json:"ids"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Len(t, result.IDs, 2)
+
+	assert.Equal(t, http.StatusConflict, putBatch(httpHandler, "batched", "c", "d").Code)
+	assert.Equal(t, http.StatusBadRequest, putBatch(httpHandler, "batched", "c", "").Code)
+	assert.Equal(t, http.StatusBadRequest, putBatch(httpHandler, "batched").Code)
+	assert.Equal(t, http.StatusOK, putBatch(httpHandler, "batched", "c").Code)
+
+	items := getBatch(t, httpHandler, "/queue/batched?max=10")
+	assert.Equal(t, []string{"a", "b", "c"}, contentsOf(items))
+	assert.Equal(t, result.IDs, []string{items[0].ID, items[1].ID})
+}
+
+func Test_GetBatch_ReturnsUpToMax(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "batched", "a", "b", "c").Code)
+
+	items := getBatch(t, httpHandler, "/queue/batched?max=2&visibility_timeout=60")
+	assert.Equal(t, []string{"a", "b"}, contentsOf(items))
+	assert.NotEqual(t, items[0].Receipt, items[1].Receipt)
+
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "batched", "ack", items[0].Receipt).Code)
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "batched", "nack", items[1].Receipt).Code)
+
+	items = getBatch(t, httpHandler, "/queue/batched?max=5")
+	assert.Equal(t, []string{"b", "c"}, contentsOf(items))
+	assert.Empty(t, items[0].Receipt)
+
+	for _, query := range []string{"max=0", "max=-1", "max=many"} {
+		req := httptest.NewRequest(http.MethodGet, "/queue/batched?"+query, nil)
+		resp := httptest.NewRecorder()
+		httpHandler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
+
+func Test_GetBatch_LongPollReturnsFirstAvailable(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "polled", "create").Code)
+	getMessage(t, httpHandler, "/queue/polled")
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		putMessage(httpHandler, "polled", "single")
+	}()
+
+	start := time.Now()
+	items := getBatch(t, httpHandler, "/queue/polled?max=10&timeout=5")
+	assert.Equal(t, []string{"single"}, contentsOf(items))
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/queue/polled?max=10&timeout=0", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func subscribe(t *testing.T, httpHandler http.Handler, topicName, queueName string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/topic/"+topicName+"/subscriptions", bytes.NewReader([]byte(`{"queue": "`+queueName+`"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+}
+
+func publish(httpHandler http.Handler, topicName, content string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(valueobject.Message{Content: content})
+	req := httptest.NewRequest(http.MethodPut, "/topic/"+topicName, bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+type publishResult struct {
+	IDs     map[string]string `json:"ids"`
+	Skipped []string          `json:"skipped"`
+}
+
+func Test_Topic_FansOutToSubscribers(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	assert.Equal(t, http.StatusNotFound, publish(httpHandler, "events", "nobody listens").Code)
+
+	subscribe(t, httpHandler, "events", "billing")
+	subscribe(t, httpHandler, "events", "audit")
+	subscribe(t, httpHandler, "events", "audit")
+
+	req := httptest.NewRequest(http.MethodGet, "/topic/events/subscriptions", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"queues": ["billing", "audit"]}`, resp.Body.String())
+
+	resp = publish(httpHandler, "events", "created")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var result publishResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(t, result.IDs, 2)
+
+	billing := getMessage(t, httpHandler, "/queue/billing")
+	audit := getMessage(t, httpHandler, "/queue/audit")
+	assert.Equal(t, "created", billing.Content)
+	assert.Equal(t, "created", audit.Content)
+	assert.Equal(t, result.IDs["billing"], billing.ID)
+	assert.NotEqual(t, billing.ID, audit.ID)
+
+	req = httptest.NewRequest(http.MethodDelete, "/topic/events/subscriptions/billing", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/topic/events/subscriptions/billing", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	require.Equal(t, http.StatusOK, publish(httpHandler, "events", "updated").Code)
+	assert.Equal(t, "updated", getMessage(t, httpHandler, "/queue/audit").Content)
+
+	req = httptest.NewRequest(http.MethodGet, "/queue/billing?timeout=0", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func Test_Topic_LimitsMessageSize(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxMessageSize = 8
+	httpHandler := newHttpHandler(t, cfg)
+
+	subscribe(t, httpHandler, "events", "audit")
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, publish(httpHandler, "events", "123456789").Code)
+
+	// An unterminated body is rejected for its size before it is read in full
+	body := io.MultiReader(strings.NewReader(`{"message": "`), bytes.NewReader(bytes.Repeat([]byte("x"), 8<<20)))
+	req := httptest.NewRequest(http.MethodPut, "/topic/events", body)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+
+	require.Equal(t, http.StatusOK, publish(httpHandler, "events", "12345678").Code)
+	assert.Equal(t, "12345678", getMessage(t, httpHandler, "/queue/audit").Content)
+}
+
+func Test_Topic_FullSubscriberPolicies(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []model.FullSubscriberPolicy{model.FullSubscriberReject, model.FullSubscriberSkip} {
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig()
+			cfg.maxMessages = 1
+			cfg.fullSubscriber = string(policy)
+			httpHandler := newHttpHandler(t, cfg)
+
+			subscribe(t, httpHandler, "events", "fast")
+			subscribe(t, httpHandler, "events", "slow")
+
+			require.Equal(t, http.StatusOK, publish(httpHandler, "events", "first").Code)
+			assert.Equal(t, "first", getMessage(t, httpHandler, "/queue/fast").Content)
+
+			resp := publish(httpHandler, "events", "second")
+
+			req := httptest.NewRequest(http.MethodGet, "/queue/fast?timeout=0", nil)
+			fastResp := httptest.NewRecorder()
+			httpHandler.ServeHTTP(fastResp, req)
+
+			if policy == model.FullSubscriberReject {
+				assert.Equal(t, http.StatusConflict, resp.Code)
+				assert.Equal(t, http.StatusNotFound, fastResp.Code, "no subscriber gets a rejected message")
+
+				return
+			}
+
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			var result publishResult
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			assert.Equal(t, []string{"slow"}, result.Skipped)
+			assert.Contains(t, result.IDs, "fast")
+			assert.Equal(t, http.StatusOK, fastResp.Code)
+		})
+	}
+}
+
+func Test_Topic_FullSubscriberPolicies_ByteLimits(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		limit      func(cfg *config)
+		rejectCode int
+	}{
+		"queue bytes": {func(cfg *config) { cfg.maxQueueBytes = 6 }, http.StatusConflict},
+		"total bytes": {func(cfg *config) { cfg.maxTotalBytes = 10 }, http.StatusRequestEntityTooLarge},
+	} {
+		for _, policy := range []model.FullSubscriberPolicy{model.FullSubscriberReject, model.FullSubscriberSkip} {
+			t.Run(name+"/"+string(policy), func(t *testing.T) {
+				t.Parallel()
+
+				cfg := testConfig()
+				cfg.maxMessages = 0
+				cfg.fullSubscriber = string(policy)
+				test.limit(&cfg)
+				httpHandler := newHttpHandler(t, cfg)
+
+				subscribe(t, httpHandler, "events", "fast")
+				subscribe(t, httpHandler, "events", "slow")
+
+				require.Equal(t, http.StatusOK, publish(httpHandler, "events", "aaaa").Code)
+				assert.Equal(t, "aaaa", getMessage(t, httpHandler, "/queue/fast").Content)
+
+				resp := publish(httpHandler, "events", "bbbb")
+				fastResp := doRequest(httpHandler, http.MethodGet, "/queue/fast?timeout=0")
+
+				if policy == model.FullSubscriberReject {
+					assert.Equal(t, test.rejectCode, resp.Code)
+					assert.Equal(t, http.StatusNotFound, fastResp.Code, "no subscriber gets a rejected message")
+
+					return
+				}
+
+				require.Equal(t, http.StatusOK, resp.Code)
+
+				var result publishResult
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+				assert.Contains(t, result.Skipped, "slow")
+				assert.Equal(t, http.StatusOK, fastResp.Code)
+			})
+		}
+	}
+}
+
+func Test_FileStorage_RestoresSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+	cfg.segmentSize = 128
+	cfg.maxMessages = 0
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	subscribe(t, httpHandler, "events", "kept")
+	subscribe(t, httpHandler, "events", "dropped")
+
+	req := httptest.NewRequest(http.MethodDelete, "/topic/events/subscriptions/dropped", nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// Roll and compact segments, so subscriptions survive only in segment headers
+	for i := range 10 {
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, "filler", fmt.Sprint("filler-", i)).Code)
+		getMessage(t, httpHandler, "/queue/filler")
+	}
+
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+
+	req = httptest.NewRequest(http.MethodGet, "/topic/events/subscriptions", nil)
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"queues": ["kept"]}`, resp.Body.String())
+}
+
+func Test_FileStorage_PurgeThenRollRestoresSegments(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+	// Every record rolls the segment
+	cfg.segmentSize = 1
+	cfg.maxMessages = 0
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "held", "held").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "purged", "x").Code)
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodPost, "/queue/purged/purge").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "kept", "kept").Code)
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+
+	// The held message keeps the segment of the purge until the message put after it is deleted
+	assert.Equal(t, "kept", getMessage(t, httpHandler, "/queue/kept").Content)
+	assert.Equal(t, "held", getMessage(t, httpHandler, "/queue/held").Content)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "kept", "after").Code)
+	assert.Equal(t, "after", getMessage(t, httpHandler, "/queue/kept").Content)
+
+	segments, err := filepath.Glob(filepath.Join(cfg.dataDir, "*.log"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(segments), 2, "segments without live messages are compacted")
+}
+
+func doRequest(httpHandler http.Handler, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func Test_QueueManagement_ListAndStats(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	assert.JSONEq(t, `{"queues": []}`, doRequest(httpHandler, http.MethodGet, "/queues").Body.String())
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "orders", "first").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "orders", "second").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "audit", "entry").Code)
+
+	req := httptest.NewRequest(http.MethodPut, "/queue/orders?delay=1h", bytes.NewReader([]byte(`{"message": "later"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	reserveMessage(t, httpHandler, "/queue/orders?visibility_timeout=60", "first")
+	getMessage(t, httpHandler, "/queue/audit")
+
+	go doRequest(httpHandler, http.MethodGet, "/queue/audit?timeout=2")
+	time.Sleep(100 * time.Millisecond)
+
+	assert.JSONEq(t, `{"queues": ["audit", "orders"]}`, doRequest(httpHandler, http.MethodGet, "/queues").Body.String())
+
+	var stats struct {
+		Name             string  `json:"name"`
+		Depth            int     `json:"depth"`
+		Reserved         int     `json:"reserved"`
+		Scheduled        int     `json:"scheduled"`
+		Waiters          int     `json:"waiters"`
+		OldestMessageAge float64 `json:"oldest_message_age_seconds"`
+	}
+
+	resp = doRequest(httpHandler, http.MethodGet, "/queue/orders/stats")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Equal(t, "orders", stats.Name)
+	assert.Equal(t, 1, stats.Depth)
+	assert.Equal(t, 1, stats.Reserved)
+	assert.Equal(t, 1, stats.Scheduled)
+	assert.Zero(t, stats.Waiters)
+	assert.Greater(t, stats.OldestMessageAge, 0.0)
+
+	resp = doRequest(httpHandler, http.MethodGet, "/queue/audit/stats")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Zero(t, stats.Depth)
+	assert.Equal(t, 1, stats.Waiters)
+	assert.Zero(t, stats.OldestMessageAge)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/missing/stats").Code)
+}
+
+func Test_QueueManagement_Purge(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "purged", "a", "b", "c").Code)
+	receipt := reserveMessage(t, httpHandler, "/queue/purged?visibility_timeout=60", "a")
+
+	resp := doRequest(httpHandler, http.MethodPost, "/queue/purged/purge")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"purged": 3}`, resp.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, postReceipt(httpHandler, "purged", "ack", receipt).Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/purged?timeout=0").Code)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "purged", "after").Code)
+	assert.Equal(t, "after", getMessage(t, httpHandler, "/queue/purged").Content)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodPost, "/queue/missing/purge").Code)
+}
+
+func Test_QueueManagement_DeleteWakesWaitersAndFreesBroker(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxQueues = 1
+	httpHandler := newHttpHandler(t, cfg)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "old", "first").Code)
+	getMessage(t, httpHandler, "/queue/old")
+	assert.Equal(t, http.StatusConflict, putMessage(httpHandler, "new", "rejected").Code)
+
+	waiterCode := make(chan int, 1)
+	go func() {
+		waiterCode <- doRequest(httpHandler, http.MethodGet, "/queue/old?timeout=5").Code
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodDelete, "/queue/old").Code)
+
+	select {
+	case code := <-waiterCode:
+		assert.Equal(t, http.StatusGone, code)
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter of the deleted queue is not woken")
+	}
+
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodDelete, "/queue/old").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/old").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "new", "accepted").Code)
+}
+
+func Test_FileStorage_RestoresPurgedAndDeletedQueues(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "purged", "a", "b").Code)
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "deleted", "a", "b").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "kept", "kept").Code)
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodPost, "/queue/purged/purge").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "purged", "after purge").Code)
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodDelete, "/queue/deleted").Code)
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+
+	assert.JSONEq(t, `{"queues": ["kept", "purged"]}`, doRequest(httpHandler, http.MethodGet, "/queues").Body.String())
+	assert.Equal(t, "after purge", getMessage(t, httpHandler, "/queue/purged").Content)
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/purged?timeout=0").Code)
+	assert.Equal(t, "kept", getMessage(t, httpHandler, "/queue/kept").Content)
+}
+
+func Test_IdleQueueReaper_DeletesIdleEmptyQueues(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxQueues = 4
+	cfg.idleQueueTimeout = 1
+	cfg.keepIdleQueues = "kept-*, pinned"
+	httpHandler := newHttpHandler(t, cfg)
+
+	for _, queueName := range []string{"one-off", "kept-1", "busy", "waited"} {
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, queueName, "message").Code)
+
+		if queueName != "busy" {
+			getMessage(t, httpHandler, "/queue/"+queueName)
+		}
+	}
+
+	assert.Equal(t, http.StatusConflict, putMessage(httpHandler, "pinned", "no room").Code)
+
+	waiterCode := make(chan int, 1)
+	go func() {
+		waiterCode <- doRequest(httpHandler, http.MethodGet, "/queue/waited?timeout=3").Code
+	}()
+
+	time.Sleep(1600 * time.Millisecond)
+
+	assert.JSONEq(t, `{"queues": ["busy", "kept-1", "waited"]}`, doRequest(httpHandler, http.MethodGet, "/queues").Body.String())
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "pinned", "room freed").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "waited", "for the waiter").Code)
+	assert.Equal(t, http.StatusOK, <-waiterCode)
+}
+
+func Test_KeepIdleQueues_InvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.keepIdleQueues = "[unclosed"
+
+	_, _, err := getHandlers(cfg)
+	assert.Error(t, err)
+}
+
+func putConfig(httpHandler http.Handler, queueName, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/queue/"+queueName+"/config", bytes.NewReader([]byte(body)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func Test_QueueConfig_CreatesQueueWithOwnSettings(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+
+	resp := putConfig(httpHandler, "small", `{"max_messages": 1, "max_bytes": 0, "max_message_size": 5, "wait_timeout": 0}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(t, `{
+		"type": "fifo", "max_messages": 1, "max_bytes": 0, "max_message_size": 5, "wait_timeout": 0, "retention": 0,
+		"overflow_policy": "reject", "block_timeout": 0, "max_deliveries": 0, "keep_idle": false
+	}`, resp.Body.String())
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putMessage(httpHandler, "small", "too large").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "small", "fits").Code)
+	assert.Equal(t, http.StatusConflict, putMessage(httpHandler, "small", "full").Code)
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "other", "default limits").Code)
+
+	assert.Equal(t, "fits", getMessage(t, httpHandler, "/queue/small").Content)
+
+	start := time.Now()
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/small").Code)
+	assert.Less(t, time.Since(start), time.Second, "queue wait timeout is used")
+
+	resp = putConfig(httpHandler, "small", `{"max_messages": 2}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(t, `{
+		"type": "fifo", "max_messages": 2, "max_bytes": 0, "max_message_size": 5, "wait_timeout": 0, "retention": 0,
+		"overflow_policy": "reject", "block_timeout": 0, "max_deliveries": 0, "keep_idle": false
+	}`, doRequest(httpHandler, http.MethodGet, "/queue/small/config").Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, putConfig(httpHandler, "small", `{"type": "priority"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, putConfig(httpHandler, "small", `{"overflow_policy": "unknown"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, putConfig(httpHandler, "small", `{"max_messages": -1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, putConfig(httpHandler, "small", `{"max_message": 1}`).Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/missing/config").Code)
+}
+
+func Test_QueueConfig_AutoCreateDisabled(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.autoCreateQueues = false
+	httpHandler := newHttpHandler(t, cfg)
+
+	assert.Equal(t, http.StatusNotFound, putMessage(httpHandler, "jobs", "message").Code)
+	assert.Equal(t, http.StatusNotFound, putBatch(httpHandler, "jobs", "a", "b").Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/topic/events/subscriptions", bytes.NewReader([]byte(`{"queue": "jobs"}`)))
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = putConfig(httpHandler, "jobs", `{"max_deliveries": 1, "dead_letter_queue": "jobs.failed"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(t, `{"queues": ["jobs", "jobs.failed"]}`, doRequest(httpHandler, http.MethodGet, "/queues").Body.String())
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "message").Code)
+	receipt := reserveMessage(t, httpHandler, "/queue/jobs?visibility_timeout=60", "message")
+	require.Equal(t, http.StatusOK, postReceipt(httpHandler, "jobs", "nack", receipt).Code)
+	assert.Equal(t, "message", getMessage(t, httpHandler, "/queue/jobs.failed").Content)
+}
+
+func Test_FileStorage_RestoresQueueConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+	cfg.segmentSize = 256
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "configured", `{"type": "priority", "max_messages": 3}`).Code)
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "configured", `{"max_message_size": 100}`).Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "implicit", "message").Code)
+
+	// Small segments roll the log, so the configs must survive in segment headers
+	for range 10 {
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, "churn", "message").Code)
+		getMessage(t, httpHandler, "/queue/churn")
+	}
+
+	require.NoError(t, shutdown.close())
+
+	cfg.maxMessages = 5
+	httpHandler = newHttpHandler(t, cfg)
+
+	assert.JSONEq(t, `{
+		"type": "priority", "max_messages": 3, "max_bytes": 0, "max_message_size": 100, "wait_timeout": 10, "retention": 0,
+		"overflow_policy": "reject", "block_timeout": 0, "max_deliveries": 0, "keep_idle": false
+	}`, doRequest(httpHandler, http.MethodGet, "/queue/configured/config").Body.String())
+	assert.JSONEq(t, `{
+		"type": "fifo", "max_messages": 10, "max_bytes": 0, "max_message_size": 0, "wait_timeout": 10, "retention": 0,
+		"overflow_policy": "reject", "block_timeout": 0, "max_deliveries": 0, "keep_idle": false
+	}`, doRequest(httpHandler, http.MethodGet, "/queue/implicit/config").Body.String())
+}
+
+func countBlockedPuts(t *testing.T, httpHandler http.Handler, queueName string) int {
+	t.Helper()
+
+	var stats struct {
+		BlockedPuts int `json:"blocked_puts"`
+	}
+
+	resp := doRequest(httpHandler, http.MethodGet, "/queue/"+queueName+"/stats")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+
+	return stats.BlockedPuts
+}
+
+func Test_Overflow_DropOldest(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "telemetry", `{"type": "priority", "max_messages": 3, "overflow_policy": "drop-oldest"}`).Code)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "telemetry", "a").Code)
+	putPriorityMessage(t, httpHandler, "telemetry", "b", 5)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "telemetry", "c").Code)
+	reserveMessage(t, httpHandler, "/queue/telemetry?visibility_timeout=60", "b")
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "telemetry", "d").Code)
+	assert.Equal(t, http.StatusConflict, putBatch(httpHandler, "telemetry", "e", "f", "g").Code, "reserved messages are not dropped")
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "telemetry", "e", "f").Code)
+
+	assert.Equal(t, []string{"e", "f"}, contentsOf(getBatch(t, httpHandler, "/queue/telemetry?max=10")))
+}
+
+func Test_Overflow_DropNewest(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "telemetry", `{"max_messages": 2, "overflow_policy": "drop-newest"}`).Code)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "telemetry", "a").Code)
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "telemetry", "b", "c").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "telemetry", "d").Code)
+
+	assert.Equal(t, []string{"a", "b"}, contentsOf(getBatch(t, httpHandler, "/queue/telemetry?max=10")))
+}
+
+func Test_Overflow_BlockReleasesProducersInOrder(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "jobs", `{"max_messages": 1, "overflow_policy": "block", "block_timeout": 10}`).Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "first").Code)
+
+	codes := make(chan int, 2)
+
+	for i, content := range []string{"second", "third"} {
+		go func() { codes <- putMessage(httpHandler, "jobs", content).Code }()
+
+		require.Eventually(t, func() bool {
+			return countBlockedPuts(t, httpHandler, "jobs") == i+1
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	assert.Equal(t, "first", getMessage(t, httpHandler, "/queue/jobs").Content)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, "second", getMessage(t, httpHandler, "/queue/jobs").Content)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, "third", getMessage(t, httpHandler, "/queue/jobs").Content)
+	assert.Zero(t, countBlockedPuts(t, httpHandler, "jobs"))
+}
+
+func Test_Overflow_BlockTimesOutOrFailsOnDelete(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "jobs", `{"max_messages": 1, "overflow_policy": "block", "block_timeout": 1}`).Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "first").Code)
+
+	start := time.Now()
+	assert.Equal(t, http.StatusConflict, putMessage(httpHandler, "jobs", "timed out").Code)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	assert.Equal(t, http.StatusConflict, putBatch(httpHandler, "jobs", "never", "fits").Code, "a batch over the limit does not wait")
+
+	code := make(chan int, 1)
+	go func() { code <- putMessage(httpHandler, "jobs", "deleted").Code }()
+
+	require.Eventually(t, func() bool {
+		return countBlockedPuts(t, httpHandler, "jobs") == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodDelete, "/queue/jobs").Code)
+	assert.Equal(t, http.StatusGone, <-code)
+
+	assert.Equal(t, http.StatusBadRequest, putConfig(httpHandler, "other", `{"overflow_policy": "block"}`).Code, "block needs a timeout")
+}
+
+func Test_ByteLimits(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxQueueBytes = 10
+	cfg.maxTotalBytes = 15
+	cfg.maxMessageSize = 8
+	httpHandler := newHttpHandler(t, cfg)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putMessage(httpHandler, "first", "123456789").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putMessage(httpHandler, "first", strings.Repeat("x", 1<<20)).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putBatch(httpHandler, "first", "1", "123456789").Code)
+
+	// An unterminated body is rejected for its size before it is read in full
+	body := io.MultiReader(strings.NewReader(`[{"message": "`), bytes.NewReader(bytes.Repeat([]byte("x"), 8<<20)))
+	req := httptest.NewRequest(http.MethodPut, "/queue/first/batch", body)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/first?timeout=0").Code, "rejected batches store nothing")
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "first", "12345678").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putMessage(httpHandler, "first", "123").Code, "queue budget")
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "first", "12").Code)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "second", "12345").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putMessage(httpHandler, "second", "1").Code, "total budget")
+
+	var stats struct {
+		Bytes int `json:"bytes"`
+	}
+
+	resp = doRequest(httpHandler, http.MethodGet, "/queue/first/stats")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Equal(t, 10, stats.Bytes)
+
+	getMessage(t, httpHandler, "/queue/first")
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "second", "1").Code)
+}
+
+func Test_ByteLimits_RejectedPutCreatesNoQueue(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxQueues = 2
+	cfg.maxTotalBytes = 5
+	httpHandler := newHttpHandler(t, cfg)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "first", "12345").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putMessage(httpHandler, "second", "1").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putBatch(httpHandler, "third", "1").Code)
+
+	getMessage(t, httpHandler, "/queue/first")
+	assert.Equal(t, http.StatusOK, putMessage(httpHandler, "fourth", "1").Code, "rejected puts took no queue")
+}
+
+func Test_ByteLimits_OverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "oldest", `{"max_bytes": 6, "overflow_policy": "drop-oldest"}`).Code)
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "newest", `{"max_bytes": 6, "overflow_policy": "drop-newest"}`).Code)
+
+	for _, queueName := range []string{"oldest", "newest"} {
+		require.Equal(t, http.StatusOK, putBatch(httpHandler, queueName, "aa", "bb", "cc").Code)
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, queueName, "dddd").Code)
+	}
+
+	assert.Equal(t, []string{"cc", "dddd"}, contentsOf(getBatch(t, httpHandler, "/queue/oldest?max=10")))
+	assert.Equal(t, []string{"aa", "bb", "cc"}, contentsOf(getBatch(t, httpHandler, "/queue/newest?max=10")))
+}
+
+func Test_Metrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.maxQueues = 1
+	cfg.maxMessages = 2
+	httpHandler := newHttpHandler(t, cfg)
+
+	require.Equal(t, http.StatusOK, putBatch(httpHandler, "orders", "a", "b").Code)
+	require.Equal(t, http.StatusConflict, putMessage(httpHandler, "orders", "c").Code)
+	require.Equal(t, http.StatusConflict, putMessage(httpHandler, "other", "d").Code)
+	getMessage(t, httpHandler, "/queue/orders")
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodGet, "/queue/orders?timeout=0").Code)
+	require.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/orders?timeout=0").Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "orders", "e").Code)
+
+	resp := doRequest(httpHandler, http.MethodGet, "/metrics")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+
+	body := resp.Body.String()
+	for _, line := range []string{
+		"# TYPE queue_messages_enqueued_total counter",
+		`queue_messages_enqueued_total{queue="orders"} 3`,
+		`queue_messages_dequeued_total{queue="orders"} 2`,
+		`queue_puts_rejected_total{queue="orders",reason="queue_full"} 1`,
+		`queue_puts_rejected_total{queue="",reason="broker_full"} 1`,
+		"# TYPE queue_wait_seconds histogram",
+		`queue_wait_seconds_count{queue="orders"} 2`,
+		`queue_wait_seconds_bucket{queue="orders",le="+Inf"} 2`,
+		`queue_wait_timeout_seconds_count{queue="orders"} 1`,
+		"# TYPE queue_depth gauge",
+		`queue_depth{queue="orders",state="visible"} 1`,
+		`queue_waiters{queue="orders"} 0`,
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_count{action="PUT /queue/{queueName}",code="409"} 2`,
+		`http_request_duration_seconds_count{action="GET /queue/{queueName}",code="404"} 1`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+
+	assert.NotContains(t, body, `queue="other"`, "queues that do not exist add no series")
+
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodDelete, "/queue/orders").Code)
+	assert.NotContains(t, doRequest(httpHandler, http.MethodGet, "/metrics").Body.String(), `queue="orders"`)
+}
+
+func Test_Metrics_RejectedPutsLabelOnlyKnownQueues(t *testing.T) {
+	t.Parallel()
+
+	handlers, shutdown, err := getHandlers(testConfig())
+	require.NoError(t, err)
+	t.Cleanup(func() { shutdown.close() })
+	httpHandler := handlers.http
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "known", "a").Code)
+	require.NoError(t, shutdown.drain())
+
+	assert.Equal(t, http.StatusServiceUnavailable, putMessage(httpHandler, "known", "b").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, putMessage(httpHandler, "random-1", "c").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, putBatch(httpHandler, "random-2", "d").Code)
+
+	body := doRequest(httpHandler, http.MethodGet, "/metrics").Body.String()
+	assert.Contains(t, body, `queue_puts_rejected_total{queue="known",reason="draining"} 1`+"\n")
+	assert.Contains(t, body, `queue_puts_rejected_total{queue="",reason="draining"} 2`+"\n")
+	assert.NotContains(t, body, `queue="random-`)
+}
+func Test_Drain(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "never"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+	t.Cleanup(func() { shutdown.close() })
+
+	assert.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodGet, "/healthz").Code)
+	assert.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodGet, "/readyz").Code)
+
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "jobs", `{"max_messages": 1, "overflow_policy": "block", "block_timeout": 30}`).Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "first").Code)
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "empty", `{}`).Code)
+
+	blockedPut := make(chan *httptest.ResponseRecorder, 1)
+	go func() { blockedPut <- putMessage(httpHandler, "jobs", "blocked") }()
+
+	waitingGet := make(chan *httptest.ResponseRecorder, 1)
+	go func() { waitingGet <- doRequest(httpHandler, http.MethodGet, "/queue/empty?timeout=30") }()
+
+	require.Eventually(t, func() bool {
+		return countBlockedPuts(t, httpHandler, "jobs") == 1 && countWaiters(t, httpHandler, "empty") == 1
+	}, time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, shutdown.drain())
+
+	for _, resp := range []*httptest.ResponseRecorder{<-blockedPut, <-waitingGet} {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, "1", resp.Header().Get("Retry-After"))
+	}
+
+	assert.Less(t, time.Since(start), time.Second)
+
+	assert.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodGet, "/healthz").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(httpHandler, http.MethodGet, "/readyz").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, putMessage(httpHandler, "empty", "late").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, putBatch(httpHandler, "empty", "late").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(httpHandler, http.MethodGet, "/queue/jobs?timeout=0").Code)
+
+	require.NoError(t, shutdown.close())
+
+	handlers, shutdown, err = getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler = handlers.http
+	t.Cleanup(func() { shutdown.close() })
+
+	assert.Equal(t, "first", getMessage(t, httpHandler, "/queue/jobs?timeout=0").Content)
+}
+
+func countWaiters(t *testing.T, httpHandler http.Handler, queueName string) int {
+	t.Helper()
+
+	var stats struct {
+		Waiters int `json:"waiters"`
+	}
+
+	resp := doRequest(httpHandler, http.MethodGet, "/queue/"+queueName+"/stats")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+
+	return stats.Waiters
+}
+
+func Test_Router_MethodNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "orders", "first").Code)
+
+	resp := doRequest(httpHandler, http.MethodPost, "/queue/orders")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	assert.Equal(t, "DELETE, GET, OPTIONS, PUT", resp.Header().Get("Allow"))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(httpHandler, http.MethodHead, "/queue/orders").Code, "HEAD does not take messages")
+	assert.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodHead, "/queue/orders/stats").Code)
+	assert.Equal(t, "first", getMessage(t, httpHandler, "/queue/orders").Content)
+
+	resp = doRequest(httpHandler, http.MethodOptions, "/queue/orders/config")
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT", resp.Header().Get("Allow"))
+}
+
+func putRaw(httpHandler http.Handler, target, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func Test_RawBody(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.storage = storageFile
+	cfg.dataDir = t.TempDir()
+	cfg.fsync = "always"
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+	httpHandler := handlers.http
+
+	image := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00, 0xfe, '"', '\n'}
+	require.Equal(t, http.StatusOK, putRaw(httpHandler, "/queue/images", "image/png", image).Code)
+	require.Equal(t, http.StatusOK, putRaw(httpHandler, "/queue/images?priority=1", "application/x-protobuf", []byte{0x08, 0x96, 0x01}).Code)
+	require.Equal(t, http.StatusOK, putRaw(httpHandler, "/queue/images", "application/json", []byte(`{"message": "json"}`)).Code)
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "images", "envelope").Code)
+	require.Equal(t, http.StatusOK, putRaw(httpHandler, "/queue/images", "application/x-www-form-urlencoded", []byte("a=1&b=2")).Code)
+	assert.Equal(t, http.StatusBadRequest, putRaw(httpHandler, "/queue/images", "text/plain", nil).Code, "empty body")
+	require.NoError(t, shutdown.close())
+
+	httpHandler = newHttpHandler(t, cfg)
+
+	resp := doRequest(httpHandler, http.MethodGet, "/queue/images?visibility_timeout=30")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/png", resp.Header().Get("Content-Type"))
+	assert.Equal(t, image, resp.Body.Bytes())
+	assert.NotEmpty(t, resp.Header().Get("X-Message-Id"))
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "images", "ack", resp.Header().Get("X-Message-Receipt")).Code)
+
+	resp = doRequest(httpHandler, http.MethodGet, "/queue/images")
+	assert.Equal(t, "application/x-protobuf", resp.Header().Get("Content-Type"))
+	assert.Equal(t, []byte{0x08, 0x96, 0x01}, resp.Body.Bytes())
+
+	assert.Equal(t, "json", getMessage(t, httpHandler, "/queue/images").Content)
+	assert.Equal(t, "envelope", getMessage(t, httpHandler, "/queue/images").Content)
+
+	resp = doRequest(httpHandler, http.MethodGet, "/queue/images")
+	assert.Equal(t, "application/x-www-form-urlencoded", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "a=1&b=2", resp.Body.String())
+}
+
+// readEvent reads the next Server-Sent Event skipping comments and returns its type and data.
+func readEvent(t *testing.T, events *bufio.Reader) (string, string) {
+	t.Helper()
+
+	eventType, data := "message", ""
+
+	for {
+		line, err := events.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && data != "":
+			return eventType, data
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func readStreamedMessage(t *testing.T, events *bufio.Reader) valueobject.Message {
+	t.Helper()
+
+	eventType, data := readEvent(t, events)
+	require.Equal(t, "message", eventType)
+
+	var message valueobject.Message
+	require.NoError(t, json.Unmarshal([]byte(data), &message))
+
+	return message
+}
+
+func Test_Stream_TakesTurnsWithLongPolls(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	server := httptest.NewServer(httpHandler)
+	t.Cleanup(server.Close)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "events", "a").Code)
+
+	resp, err := http.Get(server.URL + "/queue/events/stream")
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := bufio.NewReader(resp.Body)
+	assert.Equal(t, "a", readStreamedMessage(t, events).Content)
+
+	longPoll := make(chan valueobject.Message, 1)
+	go func() { longPoll <- getMessage(t, httpHandler, "/queue/events?timeout=5") }()
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "events") == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for _, content := range []string{"b", "c", "d"} {
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, "events", content).Code)
+	}
+
+	assert.Equal(t, "b", readStreamedMessage(t, events).Content)
+	assert.Equal(t, "c", (<-longPoll).Content, "the long poll comes before the stream served once")
+	assert.Equal(t, "d", readStreamedMessage(t, events).Content)
+
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodDelete, "/queue/events").Code)
+
+	eventType, data := readEvent(t, events)
+	assert.Equal(t, "error", eventType)
+	assert.Equal(t, model.ErrQueueDeleted.Error(), data)
+}
+
+func Test_Stream_ClientLeavingKeepsMessages(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	server := httptest.NewServer(httpHandler)
+	t.Cleanup(server.Close)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/missing/stream").Code)
+
+	require.Equal(t, http.StatusOK, putConfig(httpHandler, "events", `{}`).Code)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/queue/events/stream?visibility_timeout=30", nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	events := bufio.NewReader(resp.Body)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "events", "reserved").Code)
+
+	var received struct {
+		Receipt string `json:"receipt"`
+	}
+
+	_, data := readEvent(t, events)
+	require.NoError(t, json.Unmarshal([]byte(data), &received))
+	assert.Equal(t, http.StatusOK, postReceipt(httpHandler, "events", "ack", received.Receipt).Code)
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "events") == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "events", "kept").Code)
+	assert.Equal(t, "kept", getMessage(t, httpHandler, "/queue/events?timeout=0").Content)
+}
+
+type socketClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type socketEvent struct {
+	Type      string              `json:"type"`
+	ID        string              `json:"id"`
+	Queue     string              `json:"queue"`
+	Error     string              `json:"error"`
+	MessageID string              `json:"message_id"`
+	Message   valueobject.Message `json:"message"`
+	Receipt   string              `json:"receipt"`
+}
+
+func dialSocket(t *testing.T, serverURL string) *socketClient {
+	t.Helper()
+
+	addr := strings.TrimPrefix(serverURL, "http://")
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: " + addr + "\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	return &socketClient{conn: conn, reader: reader}
+}
+
+// send writes the command in a masked text frame, as clients must.
+func (c *socketClient) send(t *testing.T, command string) {
+	t.Helper()
+
+	frame := []byte{0x81}
+	if len(command) < 126 {
+		frame = append(frame, 0x80|byte(len(command)))
+	} else {
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(len(command)))
+	}
+
+	mask := []byte{7, 13, 42, 99}
+	frame = append(frame, mask...)
+
+	for i := range len(command) {
+		frame = append(frame, command[i]^mask[i%4])
+	}
+
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+// read returns the next n events, a delivered message and the answer to a command may come in any order.
+func (c *socketClient) read(t *testing.T, n int) []socketEvent {
+	t.Helper()
+
+	events := make([]socketEvent, 0, n)
+
+	for range n {
+		var header [2]byte
+		_, err := io.ReadFull(c.reader, header[:])
+		require.NoError(t, err)
+		require.Equal(t, byte(0x81), header[0])
+
+		length := int(header[1])
+		if length == 126 {
+			var extended [2]byte
+			_, err := io.ReadFull(c.reader, extended[:])
+			require.NoError(t, err)
+
+			length = int(binary.BigEndian.Uint16(extended[:]))
+		}
+
+		payload := make([]byte, length)
+		_, err = io.ReadFull(c.reader, payload)
+		require.NoError(t, err)
+
+		var e socketEvent
+		require.NoError(t, json.Unmarshal(payload, &e))
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func (c *socketClient) expectOk(t *testing.T, id string) socketEvent {
+	t.Helper()
+
+	e := c.read(t, 1)[0]
+	require.Equal(t, "ok", e.Type, e.Error)
+	assert.Equal(t, id, e.ID)
+
+	return e
+}
+
+// splitEvents returns the delivered messages in order and the other events.
+func splitEvents(events []socketEvent) ([]socketEvent, []socketEvent) {
+	var messages, others []socketEvent
+
+	for _, e := range events {
+		if e.Type == "message" {
+			messages = append(messages, e)
+		} else {
+			others = append(others, e)
+		}
+	}
+
+	return messages, others
+}
+
+func Test_Socket_DeliversUpToCredit(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	server := httptest.NewServer(httpHandler)
+	t.Cleanup(server.Close)
+
+	for _, content := range []string{"a", "b", "c"} {
+		require.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", content).Code)
+	}
+
+	client := dialSocket(t, server.URL)
+
+	client.send(t, `{"op": "subscribe", "id": "1", "queue": "jobs", "credit": 0, "visibility_timeout": 30}`)
+	client.expectOk(t, "1")
+
+	client.send(t, `{"op": "credit", "id": "2", "queue": "jobs", "credit": 1}`)
+	messages, others := splitEvents(client.read(t, 2))
+	require.Len(t, messages, 1)
+	assert.Equal(t, "a", messages[0].Message.Content)
+	assert.Equal(t, "jobs", messages[0].Queue)
+	require.NotEmpty(t, messages[0].Receipt)
+	assert.Equal(t, "2", others[0].ID)
+	receiptA := messages[0].Receipt
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "jobs") == 0
+	}, time.Second, 10*time.Millisecond, "a subscription without credit leaves the line")
+
+	client.send(t, `{"op": "credit", "id": "3", "queue": "jobs", "credit": 2}`)
+	messages, others = splitEvents(client.read(t, 3))
+	require.Len(t, messages, 2)
+	assert.Equal(t, "b", messages[0].Message.Content)
+	assert.Equal(t, "c", messages[1].Message.Content)
+	assert.Equal(t, "3", others[0].ID)
+
+	client.send(t, `{"op": "ack", "id": "4", "queue": "jobs", "receipt": "`+receiptA+`"}`)
+	client.expectOk(t, "4")
+
+	client.send(t, `{"op": "nack", "id": "5", "queue": "jobs", "receipt": "`+messages[0].Receipt+`"}`)
+	client.expectOk(t, "5")
+
+	client.send(t, `{"op": "publish", "id": "6", "queue": "jobs", "message": {"message": "d"}}`)
+	assert.NotEmpty(t, client.expectOk(t, "6").MessageID)
+
+	assert.Equal(t, "b", getMessage(t, httpHandler, "/queue/jobs?timeout=0").Content)
+	assert.Equal(t, "d", getMessage(t, httpHandler, "/queue/jobs?timeout=0").Content)
+
+	client.send(t, `{"op": "ack", "id": "7", "queue": "jobs", "receipt": "`+receiptA+`"}`)
+	assert.Equal(t, socketEvent{Type: "error", ID: "7", Queue: "jobs", Error: model.ErrReceiptNotFound.Error()}, client.read(t, 1)[0])
+
+	client.send(t, `{"op": "unsubscribe", "id": "8", "queue": "jobs"}`)
+	client.expectOk(t, "8")
+
+	client.send(t, `{"op": "unsubscribe", "id": "9", "queue": "jobs"}`)
+	assert.Equal(t, "not subscribed", client.read(t, 1)[0].Error)
+
+	client.send(t, `{"op": "shout", "id": "10"}`)
+	assert.Equal(t, "unknown op", client.read(t, 1)[0].Error)
+}
+
+func Test_Socket_PublishesToTopicsAndEndsSubscriptionsOfDeletedQueues(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := newHttpHandler(t, testConfig())
+	server := httptest.NewServer(httpHandler)
+	t.Cleanup(server.Close)
+
+	subscribe(t, httpHandler, "events", "billing")
+
+	client := dialSocket(t, server.URL)
+
+	client.send(t, `{"op": "subscribe", "id": "1", "queue": "billing", "credit": 10, "visibility_timeout": 0}`)
+	client.expectOk(t, "1")
+
+	client.send(t, `{"op": "publish", "id": "2", "topic": "events", "message": {"message": "paid"}}`)
+	messages, others := splitEvents(client.read(t, 2))
+	require.Len(t, messages, 1)
+	assert.Equal(t, "paid", messages[0].Message.Content)
+	assert.Empty(t, messages[0].Receipt, "popped messages need no ack")
+	assert.Equal(t, "2", others[0].ID)
+
+	require.Equal(t, http.StatusOK, doRequest(httpHandler, http.MethodDelete, "/queue/billing").Code)
+	assert.Equal(t, socketEvent{Type: "unsubscribed", Queue: "billing", Error: model.ErrQueueDeleted.Error()}, client.read(t, 1)[0])
+
+	client.send(t, `{"op": "credit", "id": "3", "queue": "billing", "credit": 1}`)
+	assert.Equal(t, "not subscribed", client.read(t, 1)[0].Error)
+}
+
+// newRespServer serves the Redis protocol of a new server on a random port and returns its address.
+func newRespServer(t *testing.T, cfg config) (http.Handler, string) {
+	t.Helper()
+
+	handlers, shutdown, err := getHandlers(cfg)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go handlers.resp.Serve(listener)
+
+	t.Cleanup(func() {
+		handlers.resp.Close()
+		shutdown.close()
+	})
+
+	return handlers.http, listener.Addr().String()
+}
+
+type respClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialResp(t *testing.T, addr string) *respClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &respClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *respClient) send(t *testing.T, args ...string) {
+	t.Helper()
+
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := c.conn.Write([]byte(command))
+	require.NoError(t, err)
+}
+
+// do sends the command and returns its reply: a string, an int, nil or a slice of them.
+// Errors are strings starting with "-".
+func (c *respClient) do(t *testing.T, args ...string) any {
+	t.Helper()
+
+	c.send(t, args...)
+
+	return c.read(t)
+}
+
+func (c *respClient) read(t *testing.T) any {
+	t.Helper()
+
+	line, err := c.reader.ReadString('\n')
+	require.NoError(t, err)
+
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return line
+	case ':':
+		var n int
+		_, err := fmt.Sscan(line[1:], &n)
+		require.NoError(t, err)
+
+		return n
+	case '$':
+		var size int
+		_, err := fmt.Sscan(line[1:], &size)
+		require.NoError(t, err)
+
+		if size < 0 {
+			return nil
+		}
+
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(c.reader, data)
+		require.NoError(t, err)
+
+		return string(data[:size])
+	case '*':
+		var n int
+		_, err := fmt.Sscan(line[1:], &n)
+		require.NoError(t, err)
+
+		if n < 0 {
+			return nil
+		}
+
+		values := make([]any, n)
+		for i := range values {
+			values[i] = c.read(t)
+		}
+
+		return values
+	default:
+		require.Failf(t, "unexpected reply", "%q", line)
+
+		return nil
+	}
+}
+
+func Test_Resp_ListCommands(t *testing.T) {
+	t.Parallel()
+
+	httpHandler, addr := newRespServer(t, testConfig())
+	client := dialResp(t, addr)
+
+	assert.Equal(t, "PONG", client.do(t, "PING"))
+	assert.Equal(t, "hello", client.do(t, "ping", "hello"))
+
+	assert.Equal(t, 2, client.do(t, "RPUSH", "jobs", "a", "b"))
+	assert.Equal(t, 3, client.do(t, "LPUSH", "jobs", "c"), "the queue orders messages, LPUSH puts to the tail too")
+	assert.Equal(t, 3, client.do(t, "LLEN", "jobs"))
+
+	assert.Equal(t, "a", client.do(t, "LPOP", "jobs"))
+	assert.Equal(t, []any{"b", "c"}, client.do(t, "LPOP", "jobs", "5"))
+	assert.Nil(t, client.do(t, "LPOP", "jobs"))
+	assert.Nil(t, client.do(t, "LPOP", "jobs", "2"))
+	assert.Nil(t, client.do(t, "LPOP", "missing"))
+	assert.Equal(t, 0, client.do(t, "LLEN", "missing"))
+
+	require.Equal(t, http.StatusOK, putMessage(httpHandler, "jobs", "from http").Code)
+	assert.Equal(t, "from http", client.do(t, "LPOP", "jobs"))
+
+	assert.Equal(t, 1, client.do(t, "RPUSH", "jobs", "\x00binary\r\n"))
+	resp := doRequest(httpHandler, http.MethodGet, "/queue/jobs?timeout=0")
+	assert.Equal(t, "application/octet-stream", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "\x00binary\r\n", resp.Body.String())
+
+	assert.Equal(t, 1, client.do(t, "DEL", "jobs", "missing"))
+	assert.Equal(t, http.StatusNotFound, doRequest(httpHandler, http.MethodGet, "/queue/jobs?timeout=0").Code)
+
+	assert.Equal(t, "-ERR unknown command 'GET'", client.do(t, "GET", "jobs"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'llen' command", client.do(t, "LLEN"))
+	assert.Equal(t, "-ERR BLPOP of several keys is not supported", client.do(t, "BLPOP", "a", "b", "1"))
+
+	_, err := client.conn.Write([]byte("PING inline\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "inline", client.read(t))
+
+	_, err = client.conn.Write([]byte("*1\r\n+PING\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "-ERR protocol error: expected '$'", client.read(t))
+
+	_, err = client.reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF, "a protocol error closes the connection")
+}
+
+func Test_Resp_BlockingPopTakesTurnsWithLongPolls(t *testing.T) {
+	t.Parallel()
+
+	httpHandler, addr := newRespServer(t, testConfig())
+	consumer := dialResp(t, addr)
+	producer := dialResp(t, addr)
+
+	assert.Nil(t, consumer.do(t, "BLPOP", "jobs", "0.05"))
+
+	consumer.send(t, "BLPOP", "jobs", "5")
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "jobs") == 1
+	}, time.Second, 10*time.Millisecond, "BLPOP waits for a queue that has no puts yet")
+
+	longPoll := make(chan string, 1)
+	go func() { longPoll <- doRequest(httpHandler, http.MethodGet, "/queue/jobs?timeout=5").Body.String() }()
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "jobs") == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 0, producer.do(t, "RPUSH", "jobs", "a"))
+	assert.Equal(t, []any{"jobs", "a"}, consumer.read(t), "BLPOP came first")
+
+	assert.Equal(t, 0, producer.do(t, "RPUSH", "jobs", "b"))
+	assert.Equal(t, "b", <-longPoll, "values put over RESP are read over HTTP as is")
+
+	leaving := dialResp(t, addr)
+	leaving.send(t, "BLPOP", "jobs", "0")
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "jobs") == 1
+	}, time.Second, 10*time.Millisecond)
+
+	leaving.conn.Close()
+
+	require.Eventually(t, func() bool {
+		return countWaiters(t, httpHandler, "jobs") == 0
+	}, time.Second, 10*time.Millisecond, "a client leaving ends its BLPOP")
+
+	assert.Equal(t, 1, producer.do(t, "RPUSH", "jobs", "kept"))
+	assert.Equal(t, "kept", producer.do(t, "LPOP", "jobs"))
+}
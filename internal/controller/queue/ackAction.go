@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type AckAction struct {
+	acker *usecase.MessageAcker
+}
+
+func NewAckAction(acker *usecase.MessageAcker) *AckAction {
+	return &AckAction{acker: acker}
+}
+
+func (a *AckAction) Route() string {
+	return "/queue/{queueName}/ack/{receipt}"
+}
+
+func (a *AckAction) Method() string {
+	return http.MethodPost
+}
+
+func (a *AckAction) Handle(w http.ResponseWriter, _ *http.Request, params transport.Params) {
+	queueName, receipt := params["queueName"], params["receipt"]
+	if queueName == "" || receipt == "" {
+		http.Error(w, "invalid queue name or receipt", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := a.acker.Ack(queueName, receipt); err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound),
+			errors.Is(err, model.ErrReceiptNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+	"time"
+)
+
+type ConfigAction struct {
+	manager *usecase.QueueManager
+}
+
+// queueConfig is model.QueueConfig with durations in seconds.
+type queueConfig struct {
+	Type            string `json:"type"`
+	MaxMessages     int    `json:"max_messages"`
+	MaxBytes        int    `json:"max_bytes"`
+	MaxMessageSize  int    `json:"max_message_size"`
+	WaitTimeout     int    `json:"wait_timeout"`
+	Retention       int    `json:"retention"`
+	OverflowPolicy  string `json:"overflow_policy"`
+	BlockTimeout    int    `json:"block_timeout"`
+	MaxDeliveries   int    `json:"max_deliveries"`
+	DeadLetterQueue string `json:"dead_letter_queue,omitempty"`
+	KeepIdle        bool   `json:"keep_idle"`
+}
+
+func NewConfigAction(manager *usecase.QueueManager) *ConfigAction {
+	return &ConfigAction{manager: manager}
+}
+
+func (a *ConfigAction) Route() string {
+	return "/queue/{queueName}/config"
+}
+
+func (a *ConfigAction) Method() string {
+	return http.MethodPut
+}
+
+// Handle creates or reconfigures the queue. Fields missing in the body keep the current value of the queue,
+// or the default one for a new queue.
+func (a *ConfigAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	current, err := a.manager.GetConfig(queueName)
+	if errors.Is(err, model.ErrQueueNotFound) {
+		current, err = a.manager.DefaultConfig(queueName), nil
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	request := newQueueConfig(current)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "invalid config", http.StatusBadRequest)
+
+		return
+	}
+
+	config := request.toModel()
+
+	if err := a.manager.Configure(queueName, config); err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidQueueConfig):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, model.ErrBrokerIsFull):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newQueueConfig(config))
+}
+
+func newQueueConfig(config model.QueueConfig) queueConfig {
+	return queueConfig{
+		Type:            string(config.Type),
+		MaxMessages:     config.MaxMessages,
+		MaxBytes:        config.MaxBytes,
+		MaxMessageSize:  config.MaxMessageSize,
+		WaitTimeout:     int(config.WaitTimeout / time.Second),
+		Retention:       int(config.Retention / time.Second),
+		OverflowPolicy:  string(config.OverflowPolicy),
+		BlockTimeout:    int(config.BlockTimeout / time.Second),
+		MaxDeliveries:   config.DeadLetterPolicy.MaxDeliveries,
+		DeadLetterQueue: config.DeadLetterPolicy.QueueName,
+		KeepIdle:        config.KeepIdle,
+	}
+}
+
+func (c queueConfig) toModel() model.QueueConfig {
+	return model.QueueConfig{
+		Type:           model.QueueType(c.Type),
+		MaxMessages:    c.MaxMessages,
+		MaxBytes:       c.MaxBytes,
+		MaxMessageSize: c.MaxMessageSize,
+		WaitTimeout:    time.Duration(c.WaitTimeout) * time.Second,
+		Retention:      time.Duration(c.Retention) * time.Second,
+		OverflowPolicy: model.OverflowPolicy(c.OverflowPolicy),
+		BlockTimeout:   time.Duration(c.BlockTimeout) * time.Second,
+		DeadLetterPolicy: model.DeadLetterPolicy{
+			MaxDeliveries: c.MaxDeliveries,
+			QueueName:     c.DeadLetterQueue,
+		},
+		KeepIdle: c.KeepIdle,
+	}
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type DeleteAction struct {
+	manager *usecase.QueueManager
+}
+
+func NewDeleteAction(manager *usecase.QueueManager) *DeleteAction {
+	return &DeleteAction{manager: manager}
+}
+
+func (a *DeleteAction) Route() string {
+	return "/queue/{queueName}"
+}
+
+func (a *DeleteAction) Method() string {
+	return http.MethodDelete
+}
+
+func (a *DeleteAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := a.manager.Delete(queueName); err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,23 +1,36 @@
 package queue
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"go-test-task/internal/domain/model"
 	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
 	"go-test-task/internal/transport"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+const (
+	headerMessageID         = "X-Message-Id"
+	headerMessageEnqueuedAt = "X-Message-Enqueued-At"
+	headerMessageReceipt    = "X-Message-Receipt"
+)
+
 type GetAction struct {
-	getter             *usecase.MessageGetter
-	defaultWaitTimeout time.Duration
+	getter                   *usecase.MessageGetter
+	defaultVisibilityTimeout time.Duration
 }
 
-func NewGetAction(getter *usecase.MessageGetter, defaultTimeout time.Duration) *GetAction {
-	return &GetAction{getter: getter, defaultWaitTimeout: defaultTimeout}
+type getResponse struct {
+	valueobject.Message
+	Receipt string `json:"receipt,omitempty"`
+}
+
+func NewGetAction(getter *usecase.MessageGetter, defaultVisibilityTimeout time.Duration) *GetAction {
+	return &GetAction{getter: getter, defaultVisibilityTimeout: defaultVisibilityTimeout}
 }
 
 func (a *GetAction) Route() string {
@@ -28,6 +41,11 @@ func (a *GetAction) Method() string {
 	return http.MethodGet
 }
 
+// IsUnsafe keeps HEAD requests from taking messages.
+func (a *GetAction) IsUnsafe() bool {
+	return true
+}
+
 func (a *GetAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
 	queueName, isExist := params["queueName"]
 	if !isExist || queueName == "" {
@@ -36,27 +54,88 @@ func (a *GetAction) Handle(w http.ResponseWriter, r *http.Request, params transp
 		return
 	}
 
-	waitTimeout := a.defaultWaitTimeout
+	waitTimeout := usecase.QueueWaitTimeout
 	if raw := r.URL.Query().Get("timeout"); raw != "" {
 		if n, err := strconv.Atoi(raw); err == nil {
 			waitTimeout = time.Duration(n) * time.Second
 		}
 	}
 
-	message, err := a.getter.Get(queueName, waitTimeout, r.Context())
+	visibilityTimeout := a.defaultVisibilityTimeout
+	if raw := r.URL.Query().Get("visibility_timeout"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil {
+			visibilityTimeout = time.Duration(n) * time.Second
+		}
+	}
+
+	if raw := r.URL.Query().Get("max"); raw != "" {
+		maxMessages, err := strconv.Atoi(raw)
+		if err != nil || maxMessages <= 0 {
+			http.Error(w, "invalid max", http.StatusBadRequest)
+
+			return
+		}
+
+		a.handleBatch(w, r, queueName, maxMessages, waitTimeout, visibilityTimeout)
+
+		return
+	}
+
+	message, receipt, err := a.getter.Get(queueName, waitTimeout, visibilityTimeout, r.Context())
 	if err != nil {
-		switch {
-		case errors.Is(err, model.ErrQueueNotFound),
-			errors.Is(err, model.ErrWaitTimeout),
-			errors.Is(err, model.ErrMessageNotFound):
-			http.Error(w, err.Error(), http.StatusNotFound)
-		default:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGetError(w, err)
+
+		return
+	}
+
+	w.Header().Set(headerMessageID, message.ID)
+	w.Header().Set(headerMessageEnqueuedAt, message.EnqueuedAt.Format(time.RFC3339Nano))
+
+	// A raw message goes out as it came in, with the metadata in headers
+	if message.IsRaw() {
+		if receipt != "" {
+			w.Header().Set(headerMessageReceipt, receipt)
 		}
 
+		w.Header().Set("Content-Type", cmp.Or(message.ContentType, "application/octet-stream"))
+		w.Write(message.Body)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getResponse{Message: message, Receipt: receipt})
+}
+
+// handleBatch responds with an array of up to maxMessages messages.
+func (a *GetAction) handleBatch(w http.ResponseWriter, r *http.Request, queueName string, maxMessages int, waitTimeout, visibilityTimeout time.Duration) {
+	received, err := a.getter.GetBatch(queueName, maxMessages, waitTimeout, visibilityTimeout, r.Context())
+	if err != nil {
+		writeGetError(w, err)
+
 		return
 	}
 
+	response := make([]getResponse, len(received))
+	for i, message := range received {
+		response[i] = getResponse{Message: message.Message, Receipt: message.Receipt}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(message)
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeGetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, model.ErrQueueNotFound),
+		errors.Is(err, model.ErrWaitTimeout),
+		errors.Is(err, model.ErrMessageNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, model.ErrQueueDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, model.ErrDraining):
+		transport.WriteRetryableError(w, err)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type GetConfigAction struct {
+	manager *usecase.QueueManager
+}
+
+func NewGetConfigAction(manager *usecase.QueueManager) *GetConfigAction {
+	return &GetConfigAction{manager: manager}
+}
+
+func (a *GetConfigAction) Route() string {
+	return "/queue/{queueName}/config"
+}
+
+func (a *GetConfigAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *GetConfigAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	config, err := a.manager.GetConfig(queueName)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newQueueConfig(config))
+}
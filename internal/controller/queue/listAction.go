@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"encoding/json"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type ListAction struct {
+	manager *usecase.QueueManager
+}
+
+type listResponse struct {
+	Queues []string `json:"queues"`
+}
+
+func NewListAction(manager *usecase.QueueManager) *ListAction {
+	return &ListAction{manager: manager}
+}
+
+func (a *ListAction) Route() string {
+	return "/queues"
+}
+
+func (a *ListAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *ListAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueNames, err := a.manager.ListQueues()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	if queueNames == nil {
+		queueNames = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listResponse{Queues: queueNames})
+}
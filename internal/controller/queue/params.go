@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"errors"
+	"go-test-task/internal/domain/valueobject"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// putParams are query arguments of PUT requests applied to every put message.
+type putParams struct {
+	expiresAt time.Time
+	deliverAt time.Time
+}
+
+// parseDuration accepts whole seconds, like the timeout argument, or a Go duration such as "1m30s".
+func parseDuration(raw string) (time.Duration, error) {
+	if n, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	return time.ParseDuration(raw)
+}
+
+func parsePutParams(query url.Values) (putParams, error) {
+	var params putParams
+
+	if raw := query.Get("ttl"); raw != "" {
+		ttl, err := parseDuration(raw)
+		if err != nil || ttl <= 0 {
+			return params, errors.New("invalid ttl")
+		}
+
+		params.expiresAt = time.Now().Add(ttl)
+	}
+
+	if query.Has("delay") && query.Has("deliver_at") {
+		return params, errors.New("delay and deliver_at are mutually exclusive")
+	}
+
+	if raw := query.Get("delay"); raw != "" {
+		delay, err := parseDuration(raw)
+		if err != nil || delay < 0 {
+			return params, errors.New("invalid delay")
+		}
+
+		params.deliverAt = time.Now().Add(delay)
+	}
+
+	if raw := query.Get("deliver_at"); raw != "" {
+		deliverAt, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return params, errors.New("invalid deliver_at")
+		}
+
+		params.deliverAt = deliverAt
+	}
+
+	return params, nil
+}
+
+func (p putParams) apply(message valueobject.Message) valueobject.Message {
+	if !p.expiresAt.IsZero() {
+		message.ExpiresAt = p.expiresAt
+	}
+
+	if !p.deliverAt.IsZero() {
+		message.DeliverAt = p.deliverAt
+	}
+
+	return message
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type PurgeAction struct {
+	manager *usecase.QueueManager
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func NewPurgeAction(manager *usecase.QueueManager) *PurgeAction {
+	return &PurgeAction{manager: manager}
+}
+
+func (a *PurgeAction) Route() string {
+	return "/queue/{queueName}/purge"
+}
+
+func (a *PurgeAction) Method() string {
+	return http.MethodPost
+}
+
+func (a *PurgeAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	purged, err := a.manager.Purge(queueName)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(purgeResponse{Purged: purged})
+}
@@ -7,16 +7,21 @@ import (
 	"go-test-task/internal/domain/usecase"
 	"go-test-task/internal/domain/valueobject"
 	"go-test-task/internal/transport"
+	"io"
+	"mime"
 	"net/http"
 )
 
 type PutAction struct {
 	putter *usecase.MessagePutter
+	// maxMessageSize limits messages of all queues, zero means no limit.
+	maxMessageSize int
 }
 
-func NewPutAction(putter *usecase.MessagePutter) *PutAction {
+func NewPutAction(putter *usecase.MessagePutter, maxMessageSize int) *PutAction {
 	return &PutAction{
-		putter: putter,
+		putter:         putter,
+		maxMessageSize: maxMessageSize,
 	}
 }
 
@@ -36,18 +41,53 @@ func (a *PutAction) Handle(w http.ResponseWriter, r *http.Request, params transp
 		return
 	}
 
-	var message valueobject.Message
-	if err := json.NewDecoder(r.Body).Decode(&message); err != nil || !message.IsValid() {
+	if a.maxMessageSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize(a.maxMessageSize))
+	}
+
+	message, err := readMessage(r)
+	if err != nil || !message.IsValid() {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, model.ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
 		http.Error(w, "invalid message", http.StatusBadRequest)
 
 		return
 	}
 
-	if err := a.putter.Put(queueName, message); err != nil {
+	if a.maxMessageSize > 0 && message.Size() > a.maxMessageSize {
+		http.Error(w, model.ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+		return
+	}
+
+	putParams, err := parsePutParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	messageID, err := a.putter.Put(queueName, putParams.apply(message), r.Context())
+	if err != nil {
 		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
 		case errors.Is(err, model.ErrQueueIsFull),
 			errors.Is(err, model.ErrBrokerIsFull):
 			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, model.ErrMessageTooLarge),
+			errors.Is(err, model.ErrQueueBytesExceeded),
+			errors.Is(err, model.ErrBrokerBytesExceeded):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, model.ErrQueueDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		case errors.Is(err, model.ErrDraining):
+			transport.WriteRetryableError(w, err)
 		default:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -55,5 +95,49 @@ func (a *PutAction) Handle(w http.ResponseWriter, r *http.Request, params transp
 		return
 	}
 
+	w.Header().Set(headerMessageID, messageID)
 	w.WriteHeader(http.StatusOK)
 }
+
+// maxBodySize bounds the JSON body of a message of maxMessageSize bytes, so a larger body is not read in full.
+// An escaped byte takes up to 6 bytes, and quotes and separators of an attribute take at most 6 bytes per byte of its key.
+func maxBodySize(maxMessageSize int) int64 {
+	return 12*int64(maxMessageSize) + 1024
+}
+
+// readMessage decodes the JSON envelope, or takes the body as is if it is of another content type.
+func readMessage(r *http.Request) (valueobject.Message, error) {
+	var message valueobject.Message
+
+	contentType := r.Header.Get("Content-Type")
+	if isEnvelope(contentType) {
+		err := json.NewDecoder(r.Body).Decode(&message)
+
+		return message, err
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return message, err
+	}
+
+	message.Body = body
+	message.ContentType = contentType
+
+	return message, nil
+}
+
+// isEnvelope tells the body is the JSON envelope. Without a content type the body is taken for JSON,
+// as it was before raw bodies.
+func isEnvelope(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json"
+}
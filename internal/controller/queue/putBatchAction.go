@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+// maxBatchBodyMessages is the number of messages of the largest size a limited batch body may hold.
+const maxBatchBodyMessages = 1000
+
+type PutBatchAction struct {
+	putter *usecase.MessagePutter
+	// maxMessageSize limits messages of all queues, zero means no limit.
+	maxMessageSize int
+}
+
+type putBatchResponse struct {
+	IDs []string `json:"ids"`
+}
+
+func NewPutBatchAction(putter *usecase.MessagePutter, maxMessageSize int) *PutBatchAction {
+	return &PutBatchAction{
+		putter:         putter,
+		maxMessageSize: maxMessageSize,
+	}
+}
+
+func (a *PutBatchAction) Route() string {
+	return "/queue/{queueName}/batch"
+}
+
+func (a *PutBatchAction) Method() string {
+	return http.MethodPut
+}
+
+func (a *PutBatchAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	if a.maxMessageSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyMessages*maxBodySize(a.maxMessageSize))
+	}
+
+	var messages []valueobject.Message
+	if err := json.NewDecoder(r.Body).Decode(&messages); err != nil || len(messages) == 0 {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, model.ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		http.Error(w, "invalid batch", http.StatusBadRequest)
+
+		return
+	}
+
+	putParams, err := parsePutParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	for i, message := range messages {
+		if !message.IsValid() {
+			http.Error(w, fmt.Sprintf("invalid message %d", i), http.StatusBadRequest)
+
+			return
+		}
+
+		if a.maxMessageSize > 0 && message.Size() > a.maxMessageSize {
+			http.Error(w, fmt.Sprintf("message %d: %s", i, model.ErrMessageTooLarge), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		messages[i] = putParams.apply(message)
+	}
+
+	messageIDs, err := a.putter.PutBatch(queueName, messages, r.Context())
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, model.ErrQueueIsFull),
+			errors.Is(err, model.ErrBrokerIsFull):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, model.ErrMessageTooLarge),
+			errors.Is(err, model.ErrQueueBytesExceeded),
+			errors.Is(err, model.ErrBrokerBytesExceeded):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, model.ErrQueueDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		case errors.Is(err, model.ErrDraining):
+			transport.WriteRetryableError(w, err)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(putBatchResponse{IDs: messageIDs})
+}
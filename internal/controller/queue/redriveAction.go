@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+	"strconv"
+)
+
+type RedriveAction struct {
+	redriver *usecase.DeadLetterRedriver
+}
+
+type redriveResponse struct {
+	Moved int `json:"moved"`
+}
+
+func NewRedriveAction(redriver *usecase.DeadLetterRedriver) *RedriveAction {
+	return &RedriveAction{redriver: redriver}
+}
+
+func (a *RedriveAction) Route() string {
+	return "/queue/{queueName}/redrive"
+}
+
+func (a *RedriveAction) Method() string {
+	return http.MethodPost
+}
+
+func (a *RedriveAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	maxMessages := 0
+	if raw := r.URL.Query().Get("max"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid max", http.StatusBadRequest)
+
+			return
+		}
+
+		maxMessages = n
+	}
+
+	moved, err := a.redriver.Redrive(queueName, maxMessages)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, usecase.ErrNoDeadLetterQueue):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redriveResponse{Moved: moved})
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+	"time"
+)
+
+type StatsAction struct {
+	manager *usecase.QueueManager
+}
+
+type statsResponse struct {
+	Name             string  `json:"name"`
+	Depth            int     `json:"depth"`
+	Reserved         int     `json:"reserved"`
+	Scheduled        int     `json:"scheduled"`
+	Bytes            int     `json:"bytes"`
+	Waiters          int     `json:"waiters"`
+	BlockedPuts      int     `json:"blocked_puts"`
+	OldestMessageAge float64 `json:"oldest_message_age_seconds"`
+}
+
+func NewStatsAction(manager *usecase.QueueManager) *StatsAction {
+	return &StatsAction{manager: manager}
+}
+
+func (a *StatsAction) Route() string {
+	return "/queue/{queueName}/stats"
+}
+
+func (a *StatsAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *StatsAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	stats, err := a.manager.GetStats(queueName)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	response := statsResponse{
+		Name:        queueName,
+		Depth:       stats.Visible,
+		Reserved:    stats.Reserved,
+		Scheduled:   stats.Scheduled,
+		Bytes:       stats.Bytes,
+		Waiters:     stats.Waiters,
+		BlockedPuts: stats.BlockedPuts,
+	}
+	if !stats.OldestEnqueuedAt.IsZero() {
+		response.OldestMessageAge = time.Since(stats.OldestEnqueuedAt).Seconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// streamKeepAlive is how often an idle stream sends a comment, so proxies do not drop the connection
+// and a gone client is noticed.
+const streamKeepAlive = 15 * time.Second
+
+// StreamAction pushes messages of the queue as Server-Sent Events while the client stays connected.
+type StreamAction struct {
+	getter                   *usecase.MessageGetter
+	defaultVisibilityTimeout time.Duration
+}
+
+func NewStreamAction(getter *usecase.MessageGetter, defaultVisibilityTimeout time.Duration) *StreamAction {
+	return &StreamAction{getter: getter, defaultVisibilityTimeout: defaultVisibilityTimeout}
+}
+
+func (a *StreamAction) Route() string {
+	return "/queue/{queueName}/stream"
+}
+
+func (a *StreamAction) Method() string {
+	return http.MethodGet
+}
+
+// IsUnsafe keeps HEAD requests from taking messages.
+func (a *StreamAction) IsUnsafe() bool {
+	return true
+}
+
+func (a *StreamAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	queueName, isExist := params["queueName"]
+	if !isExist || queueName == "" {
+		http.Error(w, "invalid queue name", http.StatusBadRequest)
+
+		return
+	}
+
+	visibilityTimeout := a.defaultVisibilityTimeout
+	if raw := r.URL.Query().Get("visibility_timeout"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil {
+			visibilityTimeout = time.Duration(n) * time.Second
+		}
+	}
+
+	stream, err := a.getter.Stream(queueName, visibilityTimeout)
+	if err != nil {
+		writeGetError(w, err)
+
+		return
+	}
+	defer stream.Close()
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), streamKeepAlive)
+		received, err := stream.Next(ctx)
+		cancel()
+
+		if r.Context().Err() != nil {
+			return
+		}
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			if writeEvent(w, rc, ": keep-alive\n\n") != nil {
+				return
+			}
+
+			continue
+		}
+
+		if err != nil {
+			// The client reconnects on its own, e.g. to another instance when this one drains
+			writeEvent(w, rc, fmt.Sprintf("event: error\ndata: %s\n\n", errorText(err)))
+
+			return
+		}
+
+		data, err := json.Marshal(getResponse{Message: received.Message, Receipt: received.Receipt})
+		if err == nil {
+			err = writeEvent(w, rc, fmt.Sprintf("id: %s\ndata: %s\n\n", received.Message.ID, data))
+		}
+
+		if err := stream.Done(err == nil); err != nil || r.Context().Err() != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event string) error {
+	if _, err := w.Write([]byte(event)); err != nil {
+		return err
+	}
+
+	return rc.Flush()
+}
+
+// errorText names the domain error ending the stream, the wrapping ops are of no use to the client.
+func errorText(err error) string {
+	for _, domainErr := range []error{model.ErrQueueDeleted, model.ErrDraining} {
+		if errors.Is(err, domainErr) {
+			return domainErr.Error()
+		}
+	}
+
+	return "stream failed"
+}
@@ -0,0 +1,73 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"math"
+	"strconv"
+	"time"
+)
+
+// BlockingPopCommand serves BLPOP key timeout. It waits in the same line as HTTP and stream consumers
+// of the queue, a zero timeout waits until a message comes. Waiting on several keys is not supported.
+type BlockingPopCommand struct {
+	getter *usecase.MessageGetter
+}
+
+func NewBlockingPopCommand(getter *usecase.MessageGetter) *BlockingPopCommand {
+	return &BlockingPopCommand{getter: getter}
+}
+
+func (c *BlockingPopCommand) Name() string {
+	return "BLPOP"
+}
+
+func (c *BlockingPopCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	if len(args) < 3 {
+		writeArityError(w, c.Name())
+
+		return
+	}
+
+	if len(args) > 3 {
+		w.WriteError("BLPOP of several keys is not supported")
+
+		return
+	}
+
+	seconds, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		w.WriteError("timeout is not a float or out of range")
+
+		return
+	}
+
+	if seconds < 0 {
+		w.WriteError("timeout is negative")
+
+		return
+	}
+
+	waitTimeout := time.Duration(math.MaxInt64)
+	if seconds > 0 && seconds < waitTimeout.Seconds() {
+		waitTimeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	message, err := c.getter.Pop(string(args[1]), waitTimeout, ctx)
+	if errors.Is(err, model.ErrWaitTimeout) {
+		w.WriteNullArray()
+
+		return
+	}
+
+	if err != nil {
+		w.WriteError(err.Error())
+
+		return
+	}
+
+	w.WriteArray(args[1], value(message))
+}
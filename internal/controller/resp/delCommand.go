@@ -0,0 +1,49 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+)
+
+// DelCommand serves DEL key [key ...]. It deletes the queues and replies with the number of deleted ones.
+type DelCommand struct {
+	manager *usecase.QueueManager
+}
+
+func NewDelCommand(manager *usecase.QueueManager) *DelCommand {
+	return &DelCommand{manager: manager}
+}
+
+func (c *DelCommand) Name() string {
+	return "DEL"
+}
+
+func (c *DelCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	if len(args) < 2 {
+		writeArityError(w, c.Name())
+
+		return
+	}
+
+	deleted := 0
+
+	for _, queueName := range args[1:] {
+		err := c.manager.Delete(string(queueName))
+		if errors.Is(err, model.ErrQueueNotFound) {
+			continue
+		}
+
+		if err != nil {
+			w.WriteError(err.Error())
+
+			return
+		}
+
+		deleted++
+	}
+
+	w.WriteInteger(deleted)
+}
@@ -0,0 +1,45 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+)
+
+// LenCommand serves LLEN key. Reserved and scheduled messages are not counted, they can't be popped yet.
+type LenCommand struct {
+	manager *usecase.QueueManager
+}
+
+func NewLenCommand(manager *usecase.QueueManager) *LenCommand {
+	return &LenCommand{manager: manager}
+}
+
+func (c *LenCommand) Name() string {
+	return "LLEN"
+}
+
+func (c *LenCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	if len(args) != 2 {
+		writeArityError(w, c.Name())
+
+		return
+	}
+
+	stats, err := c.manager.GetStats(string(args[1]))
+	if errors.Is(err, model.ErrQueueNotFound) {
+		w.WriteInteger(0)
+
+		return
+	}
+
+	if err != nil {
+		w.WriteError(err.Error())
+
+		return
+	}
+
+	w.WriteInteger(stats.Visible)
+}
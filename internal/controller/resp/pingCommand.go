@@ -0,0 +1,28 @@
+package resp
+
+import (
+	"context"
+	"go-test-task/internal/transport"
+)
+
+// PingCommand serves PING [message].
+type PingCommand struct{}
+
+func NewPingCommand() *PingCommand {
+	return &PingCommand{}
+}
+
+func (c *PingCommand) Name() string {
+	return "PING"
+}
+
+func (c *PingCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	switch len(args) {
+	case 1:
+		w.WriteSimpleString("PONG")
+	case 2:
+		w.WriteBulk(args[1])
+	default:
+		writeArityError(w, c.Name())
+	}
+}
@@ -0,0 +1,90 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"strconv"
+)
+
+// PopCommand serves LPOP key [count]. It doesn't wait, and popped messages need no ack.
+type PopCommand struct {
+	getter *usecase.MessageGetter
+}
+
+func NewPopCommand(getter *usecase.MessageGetter) *PopCommand {
+	return &PopCommand{getter: getter}
+}
+
+func (c *PopCommand) Name() string {
+	return "LPOP"
+}
+
+func (c *PopCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	if len(args) != 2 && len(args) != 3 {
+		writeArityError(w, c.Name())
+
+		return
+	}
+
+	queueName := string(args[1])
+
+	if len(args) == 2 {
+		message, _, err := c.getter.Get(queueName, 0, 0, ctx)
+		if isEmpty(err) {
+			w.WriteNull()
+
+			return
+		}
+
+		if err != nil {
+			w.WriteError(err.Error())
+
+			return
+		}
+
+		w.WriteBulk(value(message))
+
+		return
+	}
+
+	count, err := strconv.Atoi(string(args[2]))
+	if err != nil || count < 0 {
+		w.WriteError("value is out of range, must be positive")
+
+		return
+	}
+
+	if count == 0 {
+		w.WriteArray()
+
+		return
+	}
+
+	received, err := c.getter.GetBatch(queueName, count, 0, 0, ctx)
+	if isEmpty(err) {
+		w.WriteNullArray()
+
+		return
+	}
+
+	if err != nil {
+		w.WriteError(err.Error())
+
+		return
+	}
+
+	values := make([][]byte, len(received))
+	for i, r := range received {
+		values[i] = value(r.Message)
+	}
+
+	w.WriteArray(values...)
+}
+
+// isEmpty tells the error means no value, Redis has no empty lists.
+func isEmpty(err error) bool {
+	return errors.Is(err, model.ErrQueueNotFound) || errors.Is(err, model.ErrWaitTimeout)
+}
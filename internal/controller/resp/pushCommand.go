@@ -0,0 +1,61 @@
+package resp
+
+import (
+	"context"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/transport"
+)
+
+// PushCommand serves LPUSH and RPUSH key value [value ...]. Both put the values in order to the tail,
+// as the queue and not the client orders its messages. It replies with the number of visible messages.
+type PushCommand struct {
+	name    string
+	putter  *usecase.MessagePutter
+	manager *usecase.QueueManager
+}
+
+func NewPushCommand(name string, putter *usecase.MessagePutter, manager *usecase.QueueManager) *PushCommand {
+	return &PushCommand{name: name, putter: putter, manager: manager}
+}
+
+func (c *PushCommand) Name() string {
+	return c.name
+}
+
+func (c *PushCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	if len(args) < 3 {
+		writeArityError(w, c.name)
+
+		return
+	}
+
+	queueName := string(args[1])
+	messages := make([]valueobject.Message, 0, len(args)-2)
+
+	for _, value := range args[2:] {
+		message := valueobject.Message{Body: value}
+		if !message.IsValid() {
+			w.WriteError("empty values are not supported")
+
+			return
+		}
+
+		messages = append(messages, message)
+	}
+
+	if _, err := c.putter.PutBatch(queueName, messages, ctx); err != nil {
+		w.WriteError(err.Error())
+
+		return
+	}
+
+	stats, err := c.manager.GetStats(queueName)
+	if err != nil {
+		w.WriteError(err.Error())
+
+		return
+	}
+
+	w.WriteInteger(stats.Visible)
+}
@@ -0,0 +1,20 @@
+package resp
+
+import (
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/transport"
+	"strings"
+)
+
+func writeArityError(w *transport.RespWriter, name string) {
+	w.WriteError("wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+// value returns the value of a message put over RESP, or the content of one put as a JSON envelope.
+func value(message valueobject.Message) []byte {
+	if message.IsRaw() {
+		return message.Body
+	}
+
+	return []byte(message.Content)
+}
@@ -0,0 +1,387 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/transport"
+	"sync"
+	"time"
+)
+
+// Commands sent by the client, each one is answered by an ok or an error event with the same id.
+const (
+	// opSubscribe starts delivering messages of the queue, up to credit of them
+	opSubscribe = "subscribe"
+	// opCredit lets the subscription deliver credit more messages
+	opCredit      = "credit"
+	opUnsubscribe = "unsubscribe"
+	opAck         = "ack"
+	opNack        = "nack"
+	// opPublish puts the message to the queue or publishes it to the topic
+	opPublish = "publish"
+)
+
+// Events sent by the server.
+const (
+	eventOk      = "ok"
+	eventError   = "error"
+	eventMessage = "message"
+	// eventUnsubscribed ends a subscription the server could not go on with, e.g. of a deleted queue
+	eventUnsubscribed = "unsubscribed"
+)
+
+type command struct {
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	Queue string `json:"queue,omitempty"`
+	Topic string `json:"topic,omitempty"`
+	// Credit is the number of messages the client is ready to take
+	Credit int `json:"credit,omitempty"`
+	// VisibilityTimeout in seconds, omitted takes the server default and zero pops messages without acks
+	VisibilityTimeout *int                `json:"visibility_timeout,omitempty"`
+	Receipt           string              `json:"receipt,omitempty"`
+	Message           valueobject.Message `json:"message,omitzero"`
+}
+
+type event struct {
+	Type       string               `json:"type"`
+	ID         string               `json:"id,omitempty"`
+	Queue      string               `json:"queue,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	MessageID  string               `json:"message_id,omitempty"`
+	MessageIDs map[string]string    `json:"message_ids,omitempty"`
+	Message    *valueobject.Message `json:"message,omitempty"`
+	Receipt    string               `json:"receipt,omitempty"`
+}
+
+// session serves one connection. Commands are handled in order by serve, every subscription
+// delivers messages from a goroutine of its own.
+type session struct {
+	action *SocketAction
+	ws     *transport.WebSocket
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	subscriptions map[string]*subscription
+	mu            sync.Mutex
+	consumers     sync.WaitGroup
+}
+
+type subscription struct {
+	queueName         string
+	visibilityTimeout time.Duration
+	cancel            context.CancelFunc
+
+	credit int
+	// hasCredit wakes the consumer waiting for credit
+	hasCredit chan struct{}
+	mu        sync.Mutex
+}
+
+var errUnknownOp = errors.New("unknown op")
+var errAlreadySubscribed = errors.New("already subscribed")
+var errNotSubscribed = errors.New("not subscribed")
+var errInvalidCommand = errors.New("invalid command")
+
+func newSession(action *SocketAction, ws *transport.WebSocket) *session {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &session{action: action, ws: ws, ctx: ctx, cancel: cancel, subscriptions: make(map[string]*subscription)}
+}
+
+// serve handles commands until the connection is closed. A publish to a queue blocking producers
+// holds later commands of the connection until it ends.
+func (s *session) serve() {
+	defer func() {
+		s.cancel()
+		s.consumers.Wait()
+		s.ws.Close(transport.CloseNormal, "")
+	}()
+
+	for {
+		opcode, data, err := s.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var cmd command
+		if opcode != transport.OpText || json.Unmarshal(data, &cmd) != nil {
+			s.send(event{Type: eventError, Error: errInvalidCommand.Error()})
+
+			continue
+		}
+
+		s.handle(cmd)
+	}
+}
+
+func (s *session) handle(cmd command) {
+	var result event
+	var err error
+
+	switch cmd.Op {
+	case opSubscribe:
+		err = s.subscribe(cmd)
+	case opCredit:
+		err = s.addCredit(cmd)
+	case opUnsubscribe:
+		err = s.unsubscribe(cmd.Queue)
+	case opAck:
+		err = s.action.acker.Ack(cmd.Queue, cmd.Receipt)
+	case opNack:
+		err = s.action.acker.Nack(cmd.Queue, cmd.Receipt)
+	case opPublish:
+		result, err = s.publish(cmd)
+	default:
+		err = errUnknownOp
+	}
+
+	if err != nil {
+		s.send(event{Type: eventError, ID: cmd.ID, Queue: cmd.Queue, Error: errorText(err)})
+
+		return
+	}
+
+	result.Type = eventOk
+	result.ID = cmd.ID
+	result.Queue = cmd.Queue
+	s.send(result)
+}
+
+// subscribe opens the stream at once, so a missing queue fails the command.
+func (s *session) subscribe(cmd command) error {
+	if cmd.Queue == "" || cmd.Credit < 0 {
+		return errInvalidCommand
+	}
+
+	visibilityTimeout := s.action.defaultVisibilityTimeout
+	if cmd.VisibilityTimeout != nil {
+		visibilityTimeout = time.Duration(*cmd.VisibilityTimeout) * time.Second
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, isExist := s.subscriptions[cmd.Queue]; isExist {
+		return errAlreadySubscribed
+	}
+
+	stream, err := s.action.getter.Stream(cmd.Queue, visibilityTimeout)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Credit == 0 {
+		stream.Close()
+		stream = nil
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	sub := &subscription{
+		queueName:         cmd.Queue,
+		visibilityTimeout: visibilityTimeout,
+		cancel:            cancel,
+		credit:            cmd.Credit,
+		hasCredit:         make(chan struct{}, 1),
+	}
+	s.subscriptions[cmd.Queue] = sub
+
+	s.consumers.Add(1)
+
+	go func() {
+		defer s.consumers.Done()
+		s.consume(sub, stream, ctx)
+	}()
+
+	return nil
+}
+
+func (s *session) addCredit(cmd command) error {
+	if cmd.Credit <= 0 {
+		return errInvalidCommand
+	}
+
+	s.mu.Lock()
+	sub, isExist := s.subscriptions[cmd.Queue]
+	s.mu.Unlock()
+
+	if !isExist {
+		return errNotSubscribed
+	}
+
+	sub.addCredit(cmd.Credit)
+
+	return nil
+}
+
+func (s *session) unsubscribe(queueName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, isExist := s.subscriptions[queueName]
+	if !isExist {
+		return errNotSubscribed
+	}
+
+	sub.cancel()
+	delete(s.subscriptions, queueName)
+
+	return nil
+}
+
+func (s *session) publish(cmd command) (event, error) {
+	if !cmd.Message.IsValid() || (cmd.Queue == "") == (cmd.Topic == "") {
+		return event{}, errInvalidCommand
+	}
+
+	if s.action.maxMessageSize > 0 && cmd.Message.Size() > s.action.maxMessageSize {
+		return event{}, model.ErrMessageTooLarge
+	}
+
+	if cmd.Topic != "" {
+		result, err := s.action.publisher.Publish(cmd.Topic, cmd.Message, s.ctx)
+
+		return event{MessageIDs: result.MessageIDs}, err
+	}
+
+	messageID, err := s.action.putter.Put(cmd.Queue, cmd.Message, s.ctx)
+
+	return event{MessageID: messageID}, err
+}
+
+// consume delivers messages while the subscription has credit. Without credit it leaves the line of waiters,
+// so no message is held for it.
+func (s *session) consume(sub *subscription, stream *usecase.MessageStream, ctx context.Context) {
+	defer func() {
+		if stream != nil {
+			stream.Close()
+		}
+	}()
+
+	for {
+		if !sub.waitCredit(ctx) {
+			return
+		}
+
+		if stream == nil {
+			var err error
+			if stream, err = s.action.getter.Stream(sub.queueName, sub.visibilityTimeout); err != nil {
+				s.end(sub, err)
+
+				return
+			}
+		}
+
+		received, err := stream.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.end(sub, err)
+			}
+
+			return
+		}
+
+		message := received.Message
+		sendErr := s.send(event{Type: eventMessage, Queue: sub.queueName, Message: &message, Receipt: received.Receipt})
+
+		if err := stream.Done(sendErr == nil); err != nil {
+			s.end(sub, err)
+
+			return
+		}
+
+		if sendErr != nil {
+			return
+		}
+
+		if sub.spendCredit() == 0 {
+			stream.Close()
+			stream = nil
+		}
+	}
+}
+
+// end drops the subscription the server can't go on with and tells the client.
+// A draining broker closes the connection, so the client reconnects to another instance.
+func (s *session) end(sub *subscription, err error) {
+	s.mu.Lock()
+	if s.subscriptions[sub.queueName] == sub {
+		delete(s.subscriptions, sub.queueName)
+	}
+	s.mu.Unlock()
+
+	s.send(event{Type: eventUnsubscribed, Queue: sub.queueName, Error: errorText(err)})
+
+	if errors.Is(err, model.ErrDraining) {
+		s.ws.Close(transport.CloseGoingAway, model.ErrDraining.Error())
+	}
+}
+
+func (s *session) send(e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return s.ws.WriteMessage(transport.OpText, data)
+}
+
+func (sub *subscription) addCredit(credit int) {
+	sub.mu.Lock()
+	sub.credit += credit
+	sub.mu.Unlock()
+
+	select {
+	case sub.hasCredit <- struct{}{}:
+	default:
+	}
+}
+
+// spendCredit takes one credit for a delivered message and returns what is left.
+func (sub *subscription) spendCredit() int {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.credit--
+
+	return sub.credit
+}
+
+// waitCredit waits until the subscription has credit, it returns false if ctx is done first.
+func (sub *subscription) waitCredit(ctx context.Context) bool {
+	for {
+		sub.mu.Lock()
+		credit := sub.credit
+		sub.mu.Unlock()
+
+		if credit > 0 {
+			return ctx.Err() == nil
+		}
+
+		select {
+		case <-sub.hasCredit:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// errorText names the domain error for the client, the wrapping ops are of no use to it.
+func errorText(err error) string {
+	for _, knownErr := range []error{
+		model.ErrQueueNotFound, model.ErrQueueDeleted, model.ErrDraining, model.ErrReceiptNotFound,
+		model.ErrQueueIsFull, model.ErrBrokerIsFull, model.ErrSubscriberIsFull, model.ErrTopicNotFound,
+		model.ErrMessageTooLarge, model.ErrQueueBytesExceeded, model.ErrBrokerBytesExceeded,
+		errUnknownOp, errAlreadySubscribed, errNotSubscribed, errInvalidCommand,
+	} {
+		if errors.Is(err, knownErr) {
+			return knownErr.Error()
+		}
+	}
+
+	return err.Error()
+}
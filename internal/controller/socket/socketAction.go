@@ -0,0 +1,69 @@
+package socket
+
+import (
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+	"time"
+)
+
+// SocketAction serves queues over a WebSocket: a client subscribes to queues and gets their messages
+// as long as it has credit, acks and nacks them, and publishes, all on one connection. See session for the protocol.
+type SocketAction struct {
+	getter                   *usecase.MessageGetter
+	putter                   *usecase.MessagePutter
+	acker                    *usecase.MessageAcker
+	publisher                *usecase.TopicPublisher
+	defaultVisibilityTimeout time.Duration
+	// maxMessageSize limits published messages, zero means no limit.
+	maxMessageSize int
+}
+
+func NewSocketAction(
+	getter *usecase.MessageGetter,
+	putter *usecase.MessagePutter,
+	acker *usecase.MessageAcker,
+	publisher *usecase.TopicPublisher,
+	defaultVisibilityTimeout time.Duration,
+	maxMessageSize int,
+) *SocketAction {
+	return &SocketAction{
+		getter:                   getter,
+		putter:                   putter,
+		acker:                    acker,
+		publisher:                publisher,
+		defaultVisibilityTimeout: defaultVisibilityTimeout,
+		maxMessageSize:           maxMessageSize,
+	}
+}
+
+func (a *SocketAction) Route() string {
+	return "/ws"
+}
+
+func (a *SocketAction) Method() string {
+	return http.MethodGet
+}
+
+// IsUnsafe keeps HEAD requests away, they can't be upgraded anyway.
+func (a *SocketAction) IsUnsafe() bool {
+	return true
+}
+
+func (a *SocketAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	ws, err := transport.UpgradeWebSocket(w, r, maxFrameSize(a.maxMessageSize))
+	if err != nil {
+		return
+	}
+
+	newSession(a, ws).serve()
+}
+
+// maxFrameSize bounds a command carrying a message of maxMessageSize bytes, see queue.maxBodySize.
+func maxFrameSize(maxMessageSize int) int64 {
+	if maxMessageSize == 0 {
+		return 0
+	}
+
+	return 12*int64(maxMessageSize) + 1024
+}
@@ -0,0 +1,25 @@
+package system
+
+import (
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+// HealthAction tells the server is alive, it stays healthy while draining.
+type HealthAction struct{}
+
+func NewHealthAction() *HealthAction {
+	return &HealthAction{}
+}
+
+func (a *HealthAction) Route() string {
+	return "/healthz"
+}
+
+func (a *HealthAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *HealthAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	w.Write([]byte("ok\n"))
+}
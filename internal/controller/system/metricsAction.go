@@ -0,0 +1,56 @@
+package system
+
+import (
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/infrastructure/metrics"
+	"go-test-task/internal/transport"
+	"net/http"
+	"sync"
+)
+
+type MetricsAction struct {
+	manager  *usecase.QueueManager
+	metrics  *metrics.BrokerMetrics
+	registry *metrics.Registry
+	// mu keeps concurrent scrapes from mixing gauges of queues
+	mu sync.Mutex
+}
+
+func NewMetricsAction(manager *usecase.QueueManager, brokerMetrics *metrics.BrokerMetrics, registry *metrics.Registry) *MetricsAction {
+	return &MetricsAction{manager: manager, metrics: brokerMetrics, registry: registry}
+}
+
+func (a *MetricsAction) Route() string {
+	return "/metrics"
+}
+
+func (a *MetricsAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *MetricsAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	queueNames, err := a.manager.ListQueues()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	a.metrics.ResetQueueStats()
+
+	for _, queueName := range queueNames {
+		// A queue deleted since the listing has no stats to report
+		stats, err := a.manager.GetStats(queueName)
+		if err != nil {
+			continue
+		}
+
+		a.metrics.SetQueueStats(queueName, stats.QueueStats, stats.Waiters)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	a.registry.WriteText(w)
+}
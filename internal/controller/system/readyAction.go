@@ -0,0 +1,34 @@
+package system
+
+import (
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+// ReadyAction tells the server takes new work, it fails once the broker drains for shutdown.
+type ReadyAction struct {
+	drainer *usecase.Drainer
+}
+
+func NewReadyAction(drainer *usecase.Drainer) *ReadyAction {
+	return &ReadyAction{drainer: drainer}
+}
+
+func (a *ReadyAction) Route() string {
+	return "/readyz"
+}
+
+func (a *ReadyAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *ReadyAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	if a.drainer.IsDraining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
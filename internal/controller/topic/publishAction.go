@@ -0,0 +1,100 @@
+package topic
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type PublishAction struct {
+	publisher *usecase.TopicPublisher
+	// maxMessageSize limits published messages, zero means no limit.
+	maxMessageSize int
+}
+
+type publishResponse struct {
+	IDs     map[string]string `json:"ids"`
+	Skipped []string          `json:"skipped,omitempty"`
+}
+
+func NewPublishAction(publisher *usecase.TopicPublisher, maxMessageSize int) *PublishAction {
+	return &PublishAction{
+		publisher:      publisher,
+		maxMessageSize: maxMessageSize,
+	}
+}
+
+func (a *PublishAction) Route() string {
+	return "/topic/{topicName}"
+}
+
+func (a *PublishAction) Method() string {
+	return http.MethodPut
+}
+
+func (a *PublishAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	topicName, isExist := params["topicName"]
+	if !isExist || topicName == "" {
+		http.Error(w, "invalid topic name", http.StatusBadRequest)
+
+		return
+	}
+
+	if a.maxMessageSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize(a.maxMessageSize))
+	}
+
+	var message valueobject.Message
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil || !message.IsValid() {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, model.ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		http.Error(w, "invalid message", http.StatusBadRequest)
+
+		return
+	}
+
+	if a.maxMessageSize > 0 && message.Size() > a.maxMessageSize {
+		http.Error(w, model.ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+		return
+	}
+
+	result, err := a.publisher.Publish(topicName, message, r.Context())
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrTopicNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, model.ErrSubscriberIsFull),
+			errors.Is(err, model.ErrQueueIsFull),
+			errors.Is(err, model.ErrBrokerIsFull):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, model.ErrMessageTooLarge),
+			errors.Is(err, model.ErrQueueBytesExceeded),
+			errors.Is(err, model.ErrBrokerBytesExceeded):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, model.ErrDraining):
+			transport.WriteRetryableError(w, err)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(publishResponse{IDs: result.MessageIDs, Skipped: result.Skipped})
+}
+
+// maxBodySize bounds the JSON body of a message of maxMessageSize bytes, see queue.maxBodySize.
+func maxBodySize(maxMessageSize int) int64 {
+	return 12*int64(maxMessageSize) + 1024
+}
@@ -0,0 +1,61 @@
+package topic
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type SubscribeAction struct {
+	subscriber *usecase.TopicSubscriber
+}
+
+type subscribeRequest struct {
+	Queue string `json:"queue"`
+}
+
+func NewSubscribeAction(subscriber *usecase.TopicSubscriber) *SubscribeAction {
+	return &SubscribeAction{subscriber: subscriber}
+}
+
+func (a *SubscribeAction) Route() string {
+	return "/topic/{topicName}/subscriptions"
+}
+
+func (a *SubscribeAction) Method() string {
+	return http.MethodPost
+}
+
+func (a *SubscribeAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	topicName, isExist := params["topicName"]
+	if !isExist || topicName == "" {
+		http.Error(w, "invalid topic name", http.StatusBadRequest)
+
+		return
+	}
+
+	var request subscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Queue == "" {
+		http.Error(w, "invalid subscription", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := a.subscriber.Subscribe(topicName, request.Queue); err != nil {
+		switch {
+		case errors.Is(err, model.ErrQueueNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, model.ErrBrokerIsFull):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,54 @@
+package topic
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type SubscriptionsAction struct {
+	subscriber *usecase.TopicSubscriber
+}
+
+type subscriptionsResponse struct {
+	Queues []string `json:"queues"`
+}
+
+func NewSubscriptionsAction(subscriber *usecase.TopicSubscriber) *SubscriptionsAction {
+	return &SubscriptionsAction{subscriber: subscriber}
+}
+
+func (a *SubscriptionsAction) Route() string {
+	return "/topic/{topicName}/subscriptions"
+}
+
+func (a *SubscriptionsAction) Method() string {
+	return http.MethodGet
+}
+
+func (a *SubscriptionsAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	topicName, isExist := params["topicName"]
+	if !isExist || topicName == "" {
+		http.Error(w, "invalid topic name", http.StatusBadRequest)
+
+		return
+	}
+
+	subscribers, err := a.subscriber.GetSubscribers(topicName)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrTopicNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptionsResponse{Queues: subscribers})
+}
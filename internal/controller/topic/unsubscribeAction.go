@@ -0,0 +1,47 @@
+package topic
+
+import (
+	"errors"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/transport"
+	"net/http"
+)
+
+type UnsubscribeAction struct {
+	subscriber *usecase.TopicSubscriber
+}
+
+func NewUnsubscribeAction(subscriber *usecase.TopicSubscriber) *UnsubscribeAction {
+	return &UnsubscribeAction{subscriber: subscriber}
+}
+
+func (a *UnsubscribeAction) Route() string {
+	return "/topic/{topicName}/subscriptions/{queueName}"
+}
+
+func (a *UnsubscribeAction) Method() string {
+	return http.MethodDelete
+}
+
+func (a *UnsubscribeAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	topicName, queueName := params["topicName"], params["queueName"]
+	if topicName == "" || queueName == "" {
+		http.Error(w, "invalid subscription", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := a.subscriber.Unsubscribe(topicName, queueName); err != nil {
+		switch {
+		case errors.Is(err, model.ErrTopicNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
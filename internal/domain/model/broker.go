@@ -2,31 +2,146 @@ package model
 
 import (
 	"errors"
+	"fmt"
+	"sync/atomic"
 )
 
 var ErrBrokerIsFull = errors.New("broker is full")
 var ErrQueueNotFound = errors.New("queue not found")
+var ErrBrokerBytesExceeded = errors.New("broker byte limit exceeded")
+var ErrDraining = errors.New("broker is draining")
 
 type BrokerStorage interface {
-	CreateQueue(name string) (*Queue, error)
+	// CreateQueue returns the existing queue as is if there is one.
+	CreateQueue(name string, config QueueConfig) (*Queue, error)
+	// UpdateQueueConfig replaces the config of an existing queue.
+	UpdateQueueConfig(name string, config QueueConfig) error
 	GetQueue(name string) (*Queue, error)
 	CountQueues() (int, error)
+	// CountBytes returns the size of messages of all queues.
+	CountBytes() (int, error)
+	// ListQueues returns queue names in alphabetical order.
+	ListQueues() ([]string, error)
+	// DeleteQueue forgets the queue, its messages are kept in the QueueStorage.
+	DeleteQueue(name string) error
+}
+
+// BrokerConfig holds settings of a broker. Zero MaxQueues and MaxBytes mean no limit.
+type BrokerConfig struct {
+	MaxQueues int
+	// MaxBytes limits the size of messages of all queues.
+	MaxBytes int
+	// AutoCreate lets GetOrCreateQueue create missing queues, otherwise queues are created by ConfigureQueue only.
+	AutoCreate         bool
+	DefaultQueueConfig func(queueName string) QueueConfig
 }
 
 type Broker struct {
-	maxQueues int
-	storage   BrokerStorage
+	config     BrokerConfig
+	storage    BrokerStorage
+	isDraining atomic.Bool
 }
 
-func NewBroker(maxQueues int, repository BrokerStorage) *Broker {
-	return &Broker{maxQueues: maxQueues, storage: repository}
+func NewBroker(config BrokerConfig, repository BrokerStorage) *Broker {
+	return &Broker{config: config, storage: repository}
 }
 
 func (b *Broker) GetQueue(queueName string) (*Queue, error) {
 	return b.storage.GetQueue(queueName)
 }
 
+// Drain makes the broker reject new puts before shutdown.
+func (b *Broker) Drain() {
+	b.isDraining.Store(true)
+}
+
+func (b *Broker) IsDraining() bool {
+	return b.isDraining.Load()
+}
+
+// DefaultConfig returns the config of a queue created without one.
+func (b *Broker) DefaultConfig(queueName string) QueueConfig {
+	return b.config.DefaultQueueConfig(queueName)
+}
+
+// CreateQueue creates the queue with the default config.
 func (b *Broker) CreateQueue(queueName string) (*Queue, error) {
+	return b.createQueue(queueName, b.DefaultConfig(queueName))
+}
+
+// ConfigureQueue creates the queue with the config or replaces the config of the existing queue.
+// The type of an existing queue can't be changed, its messages are already ordered by it.
+func (b *Broker) ConfigureQueue(queueName string, config QueueConfig) (*Queue, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.DeadLetterPolicy.QueueName == queueName {
+		return nil, fmt.Errorf("%w: queue can't be its own dead-letter queue", ErrInvalidQueueConfig)
+	}
+
+	queue, err := b.GetQueue(queueName)
+	if errors.Is(err, ErrQueueNotFound) {
+		return b.createQueue(queueName, config)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if queue.Type() != config.Type {
+		return nil, fmt.Errorf("%w: type of an existing queue can't be changed", ErrInvalidQueueConfig)
+	}
+
+	if err := b.storage.UpdateQueueConfig(queueName, config); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+func (b *Broker) ListQueues() ([]string, error) {
+	return b.storage.ListQueues()
+}
+
+func (b *Broker) DeleteQueue(queueName string) error {
+	return b.storage.DeleteQueue(queueName)
+}
+
+// GetOrCreateQueue creates a missing queue with the default config if auto-creation is enabled.
+func (b *Broker) GetOrCreateQueue(queueName string) (*Queue, error) {
+	queue, err := b.GetQueue(queueName)
+	if err == nil {
+		return queue, nil
+	}
+
+	if !errors.Is(err, ErrQueueNotFound) || !b.config.AutoCreate {
+		return nil, err
+	}
+
+	return b.CreateQueue(queueName)
+}
+
+// CheckBytes returns ErrBrokerBytesExceeded if size more bytes of messages do not fit in the broker.
+// Like the queue limit of the broker, it may let concurrent puts exceed the limit a little.
+func (b *Broker) CheckBytes(size int) error {
+	if b.config.MaxBytes == 0 {
+		return nil
+	}
+
+	countBytes, err := b.storage.CountBytes()
+	if err != nil {
+		return err
+	}
+
+	if countBytes+size > b.config.MaxBytes {
+		return ErrBrokerBytesExceeded
+	}
+
+	return nil
+}
+
+func (b *Broker) createQueue(queueName string, config QueueConfig) (*Queue, error) {
 	isBrokerFull, err := b.isBrokerFull()
 	if err != nil {
 		return nil, err
@@ -36,11 +151,11 @@ func (b *Broker) CreateQueue(queueName string) (*Queue, error) {
 		return nil, ErrBrokerIsFull
 	}
 
-	return b.storage.CreateQueue(queueName)
+	return b.storage.CreateQueue(queueName, config)
 }
 
 func (b *Broker) isBrokerFull() (bool, error) {
-	if b.maxQueues == 0 {
+	if b.config.MaxQueues == 0 {
 		return false, nil
 	}
 
@@ -49,7 +164,7 @@ func (b *Broker) isBrokerFull() (bool, error) {
 		return true, err
 	}
 
-	if countQueues >= b.maxQueues {
+	if countQueues >= b.config.MaxQueues {
 		return true, nil
 	}
 
@@ -1,63 +1,600 @@
 package model
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"go-test-task/internal/domain/valueobject"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var ErrQueueIsFull = errors.New("queue is full")
 var ErrMessageNotFound = errors.New("message not found")
+var ErrReceiptNotFound = errors.New("receipt not found")
+var ErrQueueDeleted = errors.New("queue deleted")
+var ErrMessageTooLarge = errors.New("message too large")
+var ErrQueueBytesExceeded = errors.New("queue byte limit exceeded")
+var ErrInvalidQueueConfig = errors.New("invalid queue config")
+
+type QueueType string
+
+const (
+	QueueTypeFIFO QueueType = "fifo"
+	// QueueTypePriority delivers messages with a higher priority first and in put order within a priority.
+	QueueTypePriority QueueType = "priority"
+)
+
+// OverflowPolicy decides what a put to a full queue does.
+type OverflowPolicy string
+
+const (
+	// OverflowReject fails the put with ErrQueueIsFull.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDropOldest deletes the oldest visible messages to make room.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest silently drops the put messages that do not fit.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowBlock makes the put wait for room up to the block timeout. Waiting puts are stored in the order they came.
+	OverflowBlock OverflowPolicy = "block"
+)
 
 type QueueStorage interface {
+	// PutMessageToEnd holds a message with a future DeliverAt back until ReleaseDueMessages.
 	PutMessageToEnd(queueName string, message valueobject.Message) error
-	GetFirstMessage(queueName string) (valueobject.Message, error)
+	// PutMessagesToEnd puts all the messages or none of them.
+	PutMessagesToEnd(queueName string, messages []valueobject.Message) error
+	// DeleteOldestMessages deletes visible messages in put order, whatever their priority, until at least count messages
+	// and bytes bytes are deleted. If there are not enough visible messages it deletes none and returns ErrMessageNotFound.
+	DeleteOldestMessages(queueName string, count, bytes int) ([]valueobject.Message, error)
+	// ReserveFirstMessage hides the first message of the highest priority until it is deleted or released by the receipt.
+	ReserveFirstMessage(queueName, receipt string) (valueobject.Message, error)
+	GetReservedMessage(queueName, receipt string) (valueobject.Message, error)
+	DeleteReservedMessage(queueName, receipt string) (valueobject.Message, error)
+	// ReleaseReservedMessage makes a reserved message visible again at its original position.
+	ReleaseReservedMessage(queueName, receipt string) error
+	// CountMessages counts visible, reserved and not yet delivered messages, expired messages are not counted.
 	CountMessages(queueName string) (int, error)
+	// CountBytes returns the size of the messages counted by CountMessages, see valueobject.Message.Size.
+	CountBytes(queueName string) (int, error)
+	// CountTotalBytes returns the size of messages of all queues.
+	CountTotalBytes() (int, error)
+	// DeleteExpiredMessages deletes expired messages of all queues and returns their number.
+	DeleteExpiredMessages() (int, error)
+	// ReleaseDueMessages puts due messages of all queues to the end of their queues.
+	// It returns names of the queues that got messages and the next delivery time, zero if nothing is scheduled.
+	ReleaseDueMessages() ([]string, time.Time, error)
+	GetQueueStats(queueName string) (QueueStats, error)
+	// PurgeMessages deletes visible, reserved and not yet delivered messages of the queue and returns their number.
+	PurgeMessages(queueName string) (int, error)
+}
+
+// QueueStats counts messages of a queue. OldestEnqueuedAt is the enqueue time of the oldest visible message,
+// zero if there is none.
+type QueueStats struct {
+	Visible          int
+	Reserved         int
+	Scheduled        int
+	Bytes            int
+	OldestEnqueuedAt time.Time
+}
+
+// DeadLetterPolicy moves a message to the dead-letter queue once it was delivered MaxDeliveries times
+// without being acknowledged. Zero MaxDeliveries disables the policy.
+type DeadLetterPolicy struct {
+	MaxDeliveries int
+	QueueName     string
+}
+
+// QueueConfig holds settings of a queue. Zero MaxMessages, MaxBytes, MaxMessageSize and Retention mean no limit.
+type QueueConfig struct {
+	Type        QueueType
+	MaxMessages int
+	// MaxBytes limits the size of all messages of the queue.
+	MaxBytes int
+	// MaxMessageSize limits the size of a message in bytes, see valueobject.Message.Size.
+	MaxMessageSize int
+	// WaitTimeout is how long a get waits for a message unless it asks for another timeout.
+	WaitTimeout    time.Duration
+	Retention      time.Duration
+	OverflowPolicy OverflowPolicy
+	// BlockTimeout is how long a put waits for room with OverflowBlock.
+	BlockTimeout     time.Duration
+	DeadLetterPolicy DeadLetterPolicy
+	// KeepIdle exempts the queue from deleting idle queues.
+	KeepIdle bool
 }
 
 type Queue struct {
-	name        string
-	maxMessages int
-	storage     QueueStorage
+	name string
+	// config is replaced as a whole when the queue is reconfigured.
+	config atomic.Pointer[QueueConfig]
+	// lastActiveAt is the time of the last put or take in unix nanoseconds.
+	lastActiveAt atomic.Int64
+	storage      QueueStorage
+	// blockedPuts wait for room in the order they came.
+	blockedPuts  []*blockedPut
+	countBlocked atomic.Int64
+	// putMu serializes puts of the queue, so the room found for a put is still there when it is stored.
+	putMu sync.Mutex
+	// isClosed fails puts of a queue being deleted, it is guarded by putMu.
+	isClosed bool
+	// reservedMu serializes acks and releases with moves of reserved messages.
+	reservedMu sync.Mutex
+}
+
+type blockedPut struct {
+	messages []valueobject.Message
+	done     chan error
+}
+
+func NewQueue(name string, config QueueConfig, repository QueueStorage) *Queue {
+	q := &Queue{name: name, storage: repository}
+	q.config.Store(&config)
+	q.touch()
+
+	return q
+}
+
+func (t QueueType) IsValid() bool {
+	return t == QueueTypeFIFO || t == QueueTypePriority
+}
+
+func (p OverflowPolicy) IsValid() bool {
+	return p == OverflowReject || p == OverflowDropOldest || p == OverflowDropNewest || p == OverflowBlock
+}
+
+func (c QueueConfig) Validate() error {
+	switch {
+	case !c.Type.IsValid():
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidQueueConfig, c.Type)
+	case !c.OverflowPolicy.IsValid():
+		return fmt.Errorf("%w: unknown overflow policy %q", ErrInvalidQueueConfig, c.OverflowPolicy)
+	case c.MaxMessages < 0, c.MaxBytes < 0, c.MaxMessageSize < 0, c.WaitTimeout < 0, c.Retention < 0, c.BlockTimeout < 0,
+		c.DeadLetterPolicy.MaxDeliveries < 0:
+		return fmt.Errorf("%w: negative limit", ErrInvalidQueueConfig)
+	case c.OverflowPolicy == OverflowBlock && c.BlockTimeout == 0:
+		return fmt.Errorf("%w: block timeout is required", ErrInvalidQueueConfig)
+	case c.DeadLetterPolicy.MaxDeliveries > 0 && c.DeadLetterPolicy.QueueName == "":
+		return fmt.Errorf("%w: dead-letter queue is required", ErrInvalidQueueConfig)
+	}
+
+	return nil
 }
 
-func NewQueue(name string, maxMessages int, repository QueueStorage) *Queue {
-	return &Queue{name: name, maxMessages: maxMessages, storage: repository}
+// IsExceeded reports whether the message has used up its deliveries.
+func (p DeadLetterPolicy) IsExceeded(message valueobject.Message) bool {
+	return p.MaxDeliveries > 0 && message.Deliveries >= p.MaxDeliveries
 }
 
 func (q *Queue) Name() string {
 	return q.name
 }
 
-func (q *Queue) GetMessage() (valueobject.Message, error) {
-	return q.storage.GetFirstMessage(q.name)
+func (q *Queue) Type() QueueType {
+	return q.Config().Type
+}
+
+func (q *Queue) DeadLetterPolicy() DeadLetterPolicy {
+	return q.Config().DeadLetterPolicy
+}
+
+func (q *Queue) Config() QueueConfig {
+	return *q.config.Load()
 }
 
-func (q *Queue) PutMessage(message valueobject.Message) error {
-	isQueueFull, err := q.isQueueFull()
+// SetConfig applies to messages put after it, held messages keep their retention.
+// Blocked puts are retried with the new config.
+func (q *Queue) SetConfig(config QueueConfig) {
+	q.config.Store(&config)
+	q.NotifyRoom()
+}
+
+// LastActiveAt returns the time of the last put or take, or of the creation if there were none.
+func (q *Queue) LastActiveAt() time.Time {
+	return time.Unix(0, q.lastActiveAt.Load())
+}
+
+func (q *Queue) ReserveMessage(receipt string) (valueobject.Message, error) {
+	q.touch()
+
+	return q.storage.ReserveFirstMessage(q.name, receipt)
+}
+
+func (q *Queue) AckMessage(receipt string) error {
+	q.reservedMu.Lock()
+	_, err := q.storage.DeleteReservedMessage(q.name, receipt)
+	q.reservedMu.Unlock()
+
 	if err != nil {
 		return err
 	}
 
-	if isQueueFull {
+	q.NotifyRoom()
+
+	return nil
+}
+
+func (q *Queue) ReleaseMessage(receipt string) error {
+	q.reservedMu.Lock()
+	defer q.reservedMu.Unlock()
+
+	return q.storage.ReleaseReservedMessage(q.name, receipt)
+}
+
+// MoveReservedMessage passes the reserved message to move and deletes it if move returns true. No ack or release
+// of the receipt gets in between, so a message acknowledged meanwhile is never moved. It reports whether the message was moved.
+func (q *Queue) MoveReservedMessage(receipt string, move func(message valueobject.Message) bool) (bool, error) {
+	isMoved, err := q.moveReservedMessage(receipt, move)
+	if isMoved && err == nil {
+		q.NotifyRoom()
+	}
+
+	return isMoved, err
+}
+
+func (q *Queue) moveReservedMessage(receipt string, move func(message valueobject.Message) bool) (bool, error) {
+	q.reservedMu.Lock()
+	defer q.reservedMu.Unlock()
+
+	message, err := q.storage.GetReservedMessage(q.name, receipt)
+	if err != nil {
+		return false, err
+	}
+
+	if !move(message) {
+		return false, nil
+	}
+
+	_, err = q.storage.DeleteReservedMessage(q.name, receipt)
+
+	return true, err
+}
+
+// PutMessage applies the overflow policy of the queue if it is full. With OverflowBlock it waits for room
+// until ctx is done or the block timeout passes, a done ctx makes it fail at once.
+func (q *Queue) PutMessage(message valueobject.Message, ctx context.Context) error {
+	return q.PutMessages([]valueobject.Message{message}, ctx)
+}
+
+// PutMessages puts all the messages or, if they do not fit in the queue, none of them.
+// With OverflowDropNewest the messages that fit are put and the rest are dropped.
+// The overflow policy applies to both the message and the byte limit.
+func (q *Queue) PutMessages(messages []valueobject.Message, ctx context.Context) error {
+	q.touch()
+
+	config := q.Config()
+
+	for _, message := range messages {
+		if config.MaxMessageSize > 0 && message.Size() > config.MaxMessageSize {
+			return ErrMessageTooLarge
+		}
+	}
+
+	q.putMu.Lock()
+
+	if q.isClosed {
+		q.putMu.Unlock()
+
+		return ErrQueueDeleted
+	}
+
+	// A put does not overtake blocked ones
+	err := ErrQueueIsFull
+	if len(q.blockedPuts) == 0 || config.OverflowPolicy != OverflowBlock {
+		err = q.put(messages, config)
+	}
+
+	isNeverFit := config.MaxMessages > 0 && len(messages) > config.MaxMessages ||
+		config.MaxBytes > 0 && sizeOf(messages) > config.MaxBytes
+	if !isOverflow(err) || config.OverflowPolicy != OverflowBlock || isNeverFit || ctx.Err() != nil {
+		q.putMu.Unlock()
+
+		return err
+	}
+
+	blocked := &blockedPut{messages: messages, done: make(chan error, 1)}
+	q.blockedPuts = append(q.blockedPuts, blocked)
+	q.countBlocked.Add(1)
+	// Room freed after the check above was not seen by NotifyRoom without the count
+	q.putBlocked()
+	q.putMu.Unlock()
+
+	return q.waitRoom(blocked, config.BlockTimeout, err, ctx)
+}
+
+// MoveMessage puts a message moved from another queue. Whatever the overflow policy, it fails at once if the queue
+// is full, so a move neither drops messages nor waits for room.
+func (q *Queue) MoveMessage(message valueobject.Message) error {
+	q.touch()
+
+	config := q.Config()
+	config.OverflowPolicy = OverflowReject
+
+	if config.MaxMessageSize > 0 && message.Size() > config.MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	q.putMu.Lock()
+	defer q.putMu.Unlock()
+
+	if q.isClosed {
+		return ErrQueueDeleted
+	}
+
+	// A move does not overtake blocked puts
+	if len(q.blockedPuts) > 0 {
 		return ErrQueueIsFull
 	}
 
-	return q.storage.PutMessageToEnd(q.name, message)
+	return q.put([]valueobject.Message{message}, config)
+}
+
+// NotifyRoom stores blocked puts in the order they came while they fit.
+func (q *Queue) NotifyRoom() {
+	if q.countBlocked.Load() == 0 {
+		return
+	}
+
+	q.putMu.Lock()
+	defer q.putMu.Unlock()
+
+	q.putBlocked()
+}
+
+// CancelBlockedPuts fails the blocked puts with the error.
+func (q *Queue) CancelBlockedPuts(err error) {
+	q.putMu.Lock()
+	defer q.putMu.Unlock()
+
+	for _, blocked := range q.blockedPuts {
+		blocked.done <- err
+	}
+
+	q.blockedPuts = nil
+	q.countBlocked.Store(0)
+}
+
+// Close makes puts fail with ErrQueueDeleted before the queue is deleted, blocked puts included.
+func (q *Queue) Close() {
+	q.putMu.Lock()
+	defer q.putMu.Unlock()
+
+	q.close()
 }
 
-func (q *Queue) isQueueFull() (bool, error) {
-	if q.maxMessages == 0 {
+// CloseIfEmpty closes the queue only if it holds no messages. No put gets in between the check and the close,
+// so an empty queue can be deleted without losing messages. It reports whether the queue was closed.
+func (q *Queue) CloseIfEmpty() (bool, error) {
+	q.putMu.Lock()
+	defer q.putMu.Unlock()
+
+	stats, err := q.Stats()
+	if err != nil {
+		return false, err
+	}
+
+	if stats.Visible+stats.Reserved+stats.Scheduled > 0 {
 		return false, nil
 	}
 
-	countMessages, err := q.storage.CountMessages(q.name)
+	q.close()
+
+	return true, nil
+}
+
+// close must be called under q.putMu.
+func (q *Queue) close() {
+	q.isClosed = true
+
+	for _, blocked := range q.blockedPuts {
+		blocked.done <- ErrQueueDeleted
+	}
+
+	q.blockedPuts = nil
+	q.countBlocked.Store(0)
+}
+
+// CountBlockedPuts returns the number of puts waiting for room.
+func (q *Queue) CountBlockedPuts() int {
+	return int(q.countBlocked.Load())
+}
+
+func (q *Queue) Stats() (QueueStats, error) {
+	return q.storage.GetQueueStats(q.name)
+}
+
+func (q *Queue) Purge() (int, error) {
+	purged, err := q.storage.PurgeMessages(q.name)
+	if err != nil {
+		return 0, err
+	}
+
+	q.NotifyRoom()
+
+	return purged, nil
+}
+
+// IsFull reports whether the queue has no room for one more message of size bytes.
+func (q *Queue) IsFull(size int) (bool, error) {
+	room, byteRoom, err := q.room(q.Config())
 	if err != nil {
 		return true, err
 	}
 
-	if countMessages >= q.maxMessages {
-		return true, nil
+	return room < 1 || size > byteRoom, nil
+}
+
+// put must be called under q.putMu.
+func (q *Queue) put(messages []valueobject.Message, config QueueConfig) error {
+	room, byteRoom, err := q.room(config)
+	if err != nil {
+		return err
+	}
+
+	size := sizeOf(messages)
+
+	if len(messages) > room || size > byteRoom {
+		switch config.OverflowPolicy {
+		case OverflowDropOldest:
+			_, err := q.storage.DeleteOldestMessages(q.name, len(messages)-room, size-byteRoom)
+			if errors.Is(err, ErrMessageNotFound) {
+				return overflowError(len(messages) > room)
+			}
+
+			if err != nil {
+				return err
+			}
+		case OverflowDropNewest:
+			messages = fittingMessages(messages, room, byteRoom)
+		default:
+			return overflowError(len(messages) > room)
+		}
 	}
 
-	return false, nil
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if len(messages) == 1 {
+		return q.storage.PutMessageToEnd(q.name, prepareMessage(config, messages[0]))
+	}
+
+	prepared := make([]valueobject.Message, len(messages))
+	for i, message := range messages {
+		prepared[i] = prepareMessage(config, message)
+	}
+
+	return q.storage.PutMessagesToEnd(q.name, prepared)
+}
+
+// putBlocked must be called under q.putMu.
+func (q *Queue) putBlocked() {
+	config := q.Config()
+
+	for len(q.blockedPuts) > 0 {
+		err := q.put(q.blockedPuts[0].messages, config)
+		if isOverflow(err) && config.OverflowPolicy == OverflowBlock {
+			return
+		}
+
+		q.blockedPuts[0].done <- err
+		q.blockedPuts = slices.Delete(q.blockedPuts, 0, 1)
+		q.countBlocked.Add(-1)
+	}
+}
+
+// waitRoom returns overflowErr if the put is still blocked after the timeout.
+func (q *Queue) waitRoom(blocked *blockedPut, timeout time.Duration, overflowErr error, ctx context.Context) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-blocked.done:
+		return err
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	q.putMu.Lock()
+
+	i := slices.Index(q.blockedPuts, blocked)
+	if i >= 0 {
+		q.blockedPuts = slices.Delete(q.blockedPuts, i, i+1)
+		q.countBlocked.Add(-1)
+		// The next blocked put may need less room than the one that left
+		q.putBlocked()
+	}
+
+	q.putMu.Unlock()
+
+	if i < 0 {
+		// The put was stored or canceled before the waiter left
+		return <-blocked.done
+	}
+
+	return overflowErr
+}
+
+func prepareMessage(config QueueConfig, message valueobject.Message) valueobject.Message {
+	// A FIFO queue ignores priorities, so its messages stay in a single storage level.
+	if config.Type != QueueTypePriority {
+		message.Priority = 0
+	}
+
+	if config.Retention > 0 {
+		retainUntil := message.EnqueuedAt.Add(config.Retention)
+		if message.ExpiresAt.IsZero() || message.ExpiresAt.After(retainUntil) {
+			message.ExpiresAt = retainUntil
+		}
+	}
+
+	return message
+}
+
+func (q *Queue) touch() {
+	q.lastActiveAt.Store(time.Now().UnixNano())
+}
+
+// room returns how many more messages and bytes fit in the queue, negative if a limit was lowered below the queue size.
+func (q *Queue) room(config QueueConfig) (int, int, error) {
+	room, byteRoom := math.MaxInt, math.MaxInt
+
+	if config.MaxMessages > 0 {
+		countMessages, err := q.storage.CountMessages(q.name)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		room = config.MaxMessages - countMessages
+	}
+
+	if config.MaxBytes > 0 {
+		countBytes, err := q.storage.CountBytes(q.name)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		byteRoom = config.MaxBytes - countBytes
+	}
+
+	return room, byteRoom, nil
+}
+
+func sizeOf(messages []valueobject.Message) int {
+	size := 0
+	for _, message := range messages {
+		size += message.Size()
+	}
+
+	return size
+}
+
+// fittingMessages returns the first messages that fit in the room.
+func fittingMessages(messages []valueobject.Message, room, byteRoom int) []valueobject.Message {
+	size := 0
+
+	for i, message := range messages {
+		size += message.Size()
+		if i >= room || size > byteRoom {
+			return messages[:i]
+		}
+	}
+
+	return messages
+}
+
+func overflowError(isCountExceeded bool) error {
+	if isCountExceeded {
+		return ErrQueueIsFull
+	}
+
+	return ErrQueueBytesExceeded
+}
+
+func isOverflow(err error) bool {
+	return errors.Is(err, ErrQueueIsFull) || errors.Is(err, ErrQueueBytesExceeded)
 }
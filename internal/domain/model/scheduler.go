@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Scheduler releases delayed messages into their queues when they are due
+// and lets waiters take them, as a put of the message would.
+// Delayed messages themselves are kept by the storage, so the scheduler only tracks the next delivery time.
+type Scheduler struct {
+	storage QueueStorage
+	waiter  *Waiter
+	wakeCh  chan struct{}
+	nextAt  time.Time
+	mu      sync.Mutex
+}
+
+func NewScheduler(storage QueueStorage, waiter *Waiter) *Scheduler {
+	return &Scheduler{storage: storage, waiter: waiter, wakeCh: make(chan struct{}, 1)}
+}
+
+// Schedule must be called after a delayed message is stored.
+func (s *Scheduler) Schedule(deliverAt time.Time) {
+	s.mu.Lock()
+	isEarlier := s.nextAt.IsZero() || deliverAt.Before(s.nextAt)
+	if isEarlier {
+		s.nextAt = deliverAt
+	}
+	s.mu.Unlock()
+
+	if isEarlier {
+		select {
+		case s.wakeCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run releases messages until the context is done. The first pass picks up messages recovered by the storage.
+func (s *Scheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wakeCh:
+		}
+
+		queueNames, nextAt, err := s.storage.ReleaseDueMessages()
+		if err != nil {
+			log.Println("Scheduler.Run:", err)
+
+			nextAt = time.Now().Add(time.Second)
+		}
+
+		for _, queueName := range queueNames {
+			s.waiter.Notify(queueName)
+		}
+
+		s.mu.Lock()
+		s.nextAt = nextAt
+		s.mu.Unlock()
+
+		timer.Stop()
+
+		if !nextAt.IsZero() {
+			timer.Reset(time.Until(nextAt))
+		}
+	}
+}
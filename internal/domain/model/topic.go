@@ -0,0 +1,29 @@
+package model
+
+import "errors"
+
+var ErrTopicNotFound = errors.New("topic not found")
+var ErrSubscriberIsFull = errors.New("subscriber queue is full")
+
+// FullSubscriberPolicy decides what a publish does when a subscriber queue has no room for the message.
+type FullSubscriberPolicy string
+
+const (
+	// FullSubscriberReject rejects the message for all subscribers.
+	FullSubscriberReject FullSubscriberPolicy = "reject"
+	// FullSubscriberSkip delivers the message to the subscribers that have room.
+	FullSubscriberSkip FullSubscriberPolicy = "skip"
+)
+
+// TopicStorage keeps queues subscribed to topics. A topic exists while it has subscribers.
+type TopicStorage interface {
+	Subscribe(topicName, queueName string) error
+	// Unsubscribe returns ErrTopicNotFound if the queue is not subscribed to the topic.
+	Unsubscribe(topicName, queueName string) error
+	// GetSubscribers returns subscribed queue names in the order they subscribed.
+	GetSubscribers(topicName string) ([]string, error)
+}
+
+func (p FullSubscriberPolicy) IsValid() bool {
+	return p == FullSubscriberReject || p == FullSubscriberSkip
+}
@@ -4,79 +4,261 @@ import (
 	"context"
 	"errors"
 	"go-test-task/internal/domain/valueobject"
+	"hash/maphash"
 	"sync"
 	"time"
 )
 
 var ErrWaitTimeout = errors.New("wait timeout")
 
+// TakeFunc removes a message from a queue on behalf of a waiter, e.g. reserves it.
+// It must return ErrMessageNotFound when the queue has nothing to take.
+type TakeFunc func() (valueobject.Message, error)
+
+type delivery struct {
+	message valueobject.Message
+	err     error
+}
+
+type waiterEntry struct {
+	ch   chan delivery
+	take TakeFunc
+	// isPersistent entries stay in the line after a delivery, see Stream
+	isPersistent bool
+}
+
+// Stream is a persistent consumer of a queue. It stays in the line of waiters and goes to its end after every message,
+// so it takes turns with other consumers. It is skipped while a message taken for it is not received by Next.
+type Stream struct {
+	waiter    *Waiter
+	queueName string
+	ch        chan delivery
+}
+
+const waiterShards = 64
+
+type waiterShard struct {
+	waitersPerQueue map[string][]waiterEntry
+	// err fails new waiters once the Waiter is drained
+	err error
+	mu  sync.Mutex
+}
+
+// Waiter hands messages to consumers in the order they came for them.
+// Both registering a consumer and taking messages for consumers happen under the lock of the queue's shard,
+// so a message stored before Notify is either taken by a registered consumer or stays for the next one.
 type Waiter struct {
-	waitersPerQueue map[string][]chan<- valueobject.Message
-	mu              sync.Mutex
+	shards []waiterShard
+	seed   maphash.Seed
 }
 
 func NewWaiter() *Waiter {
-	return &Waiter{waitersPerQueue: make(map[string][]chan<- valueobject.Message)}
+	w := &Waiter{shards: make([]waiterShard, waiterShards), seed: maphash.MakeSeed()}
+	for i := range w.shards {
+		w.shards[i].waitersPerQueue = make(map[string][]waiterEntry)
+	}
+
+	return w
 }
 
-func (w *Waiter) WaitMessage(queueName string, waitTimeout time.Duration, ctx context.Context) (valueobject.Message, error) {
-	waiterCh := make(chan valueobject.Message)
+func (w *Waiter) WaitMessage(queueName string, take TakeFunc, waitTimeout time.Duration, ctx context.Context) (valueobject.Message, error) {
+	waiterCh := make(chan delivery, 1)
+
+	shard := w.shardOf(queueName)
+	shard.mu.Lock()
+	if err := shard.err; err != nil {
+		shard.mu.Unlock()
 
-	w.addWaiterCh(queueName, waiterCh)
+		return valueobject.Message{}, err
+	}
+
+	shard.waitersPerQueue[queueName] = append(shard.waitersPerQueue[queueName], waiterEntry{ch: waiterCh, take: take})
+	shard.dispatch(queueName)
+	shard.mu.Unlock()
+
+	timer := time.NewTimer(waitTimeout)
+	defer timer.Stop()
 
 	select {
-	case msg := <-waiterCh:
-		return msg, nil
+	case d := <-waiterCh:
+		return d.message, d.err
 	case <-ctx.Done():
-		w.deleteWaiterCh(queueName, waiterCh)
+	case <-timer.C:
+	}
 
+	if shard.deleteWaiterCh(queueName, waiterCh) {
 		return valueobject.Message{}, ErrWaitTimeout
-	case <-time.After(waitTimeout):
-		w.deleteWaiterCh(queueName, waiterCh)
+	}
 
-		return valueobject.Message{}, ErrWaitTimeout
+	// The message was taken for the waiter before it left
+	d := <-waiterCh
+
+	return d.message, d.err
+}
+
+// Stream registers a persistent consumer of the queue. The consumer must close the stream when it leaves.
+func (w *Waiter) Stream(queueName string, take TakeFunc) (*Stream, error) {
+	// A persistent entry holds at most one message, so there is always room for the error of Cancel or Drain
+	ch := make(chan delivery, 2)
+
+	shard := w.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if err := shard.err; err != nil {
+		return nil, err
 	}
+
+	shard.waitersPerQueue[queueName] = append(shard.waitersPerQueue[queueName], waiterEntry{ch: ch, take: take, isPersistent: true})
+	shard.dispatch(queueName)
+
+	return &Stream{waiter: w, queueName: queueName, ch: ch}, nil
 }
 
-func (w *Waiter) Notify(queueName string, message valueobject.Message) bool {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// Next waits for the next message taken for the consumer.
+func (s *Stream) Next(ctx context.Context) (valueobject.Message, error) {
+	// Messages stored while the consumer was busy wait for it to be ready again
+	s.waiter.Notify(s.queueName)
 
-	waiters, isExist := w.waitersPerQueue[queueName]
-	if !isExist || len(waiters) == 0 {
-		return false
+	select {
+	case d := <-s.ch:
+		return d.message, d.err
+	case <-ctx.Done():
+		return valueobject.Message{}, ctx.Err()
 	}
+}
+
+// Close takes the consumer out of the line. It returns the message taken for the consumer
+// and not received by Next, so the caller can put it back.
+func (s *Stream) Close() (valueobject.Message, bool) {
+	s.waiter.shardOf(s.queueName).deleteWaiterCh(s.queueName, s.ch)
 
-	ch := waiters[0]
-	w.waitersPerQueue[queueName] = waiters[1:]
+	select {
+	case d := <-s.ch:
+		return d.message, d.err == nil
+	default:
+		return valueobject.Message{}, false
+	}
+}
 
-	ch <- message
-	close(ch)
+// Notify lets waiters of the queue take messages that have become available.
+func (w *Waiter) Notify(queueName string) {
+	shard := w.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	return true
+	shard.dispatch(queueName)
 }
 
-func (w *Waiter) addWaiterCh(queueName string, waiterCh chan valueobject.Message) {
-	w.mu.Lock()
-	w.waitersPerQueue[queueName] = append(w.waitersPerQueue[queueName], waiterCh)
-	w.mu.Unlock()
+// CountWaiters returns the number of consumers waiting for messages of the queue.
+func (w *Waiter) CountWaiters(queueName string) int {
+	shard := w.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	return len(shard.waitersPerQueue[queueName])
 }
 
-func (w *Waiter) deleteWaiterCh(queueName string, toDeleteCh chan<- valueobject.Message) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// Cancel wakes all consumers waiting for messages of the queue with the error.
+func (w *Waiter) Cancel(queueName string, err error) {
+	shard := w.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	waiters := w.waitersPerQueue[queueName]
-	for i, waiterCh := range waiters {
-		if waiterCh == toDeleteCh {
-			w.waitersPerQueue[queueName] = append(waiters[:i], waiters[i+1:]...)
-			close(waiterCh)
+	for _, waiter := range shard.waitersPerQueue[queueName] {
+		waiter.ch <- delivery{err: err}
+	}
+
+	delete(shard.waitersPerQueue, queueName)
+}
+
+// Drain wakes all consumers of all queues with the error and fails later ones with it.
+func (w *Waiter) Drain(err error) {
+	for i := range w.shards {
+		shard := &w.shards[i]
+		shard.mu.Lock()
+
+		for _, waiters := range shard.waitersPerQueue {
+			for _, waiter := range waiters {
+				waiter.ch <- delivery{err: err}
+			}
+		}
+
+		clear(shard.waitersPerQueue)
+		shard.err = err
+		shard.mu.Unlock()
+	}
+}
 
+func (w *Waiter) shardOf(queueName string) *waiterShard {
+	return &w.shards[maphash.String(w.seed, queueName)%uint64(len(w.shards))]
+}
+
+// dispatch must be called under s.mu. Waiter channels are buffered, so sending never blocks.
+func (s *waiterShard) dispatch(queueName string) {
+	waiters := s.waitersPerQueue[queueName]
+
+	// Busy persistent entries keep their place at waiters[:kept], served ones go to the end
+	kept := 0
+	var served []waiterEntry
+
+	i := 0
+	for ; i < len(waiters); i++ {
+		if waiters[i].isBusy() {
+			waiters[kept] = waiters[i]
+			kept++
+
+			continue
+		}
+
+		message, err := waiters[i].take()
+		if errors.Is(err, ErrMessageNotFound) {
 			break
 		}
+
+		waiters[i].ch <- delivery{message: message, err: err}
+
+		if waiters[i].isPersistent {
+			served = append(served, waiters[i])
+		}
+	}
+
+	if kept > 0 || len(served) > 0 {
+		waiters = append(append(waiters[:kept], waiters[i:]...), served...)
+	} else {
+		waiters = waiters[i:]
 	}
 
-	if len(w.waitersPerQueue[queueName]) == 0 {
-		delete(w.waitersPerQueue, queueName)
+	if len(waiters) == 0 {
+		delete(s.waitersPerQueue, queueName)
+
+		return
+	}
+
+	s.waitersPerQueue[queueName] = waiters
+}
+
+func (s *waiterShard) deleteWaiterCh(queueName string, toDeleteCh chan delivery) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waiters := s.waitersPerQueue[queueName]
+	for i, waiter := range waiters {
+		if waiter.ch == toDeleteCh {
+			s.waitersPerQueue[queueName] = append(waiters[:i], waiters[i+1:]...)
+
+			if len(s.waitersPerQueue[queueName]) == 0 {
+				delete(s.waitersPerQueue, queueName)
+			}
+
+			return true
+		}
 	}
+
+	return false
+}
+
+// isBusy tells the persistent entry still holds a message its consumer has not received.
+func (e waiterEntry) isBusy() bool {
+	return e.isPersistent && len(e.ch) > 0
 }
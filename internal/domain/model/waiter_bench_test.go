@@ -0,0 +1,35 @@
+package model_test
+
+import (
+	"context"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/valueobject"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Benchmark_Waiter_ParallelQueues registers a waiter and hands it a message on a queue of its own goroutine.
+// Run with -cpu 1,2,4,8 to see throughput scale with GOMAXPROCS.
+func Benchmark_Waiter_ParallelQueues(b *testing.B) {
+	waiter := model.NewWaiter()
+	ctx := context.Background()
+	message := valueobject.Message{Content: "benchmark"}
+
+	var nextQueue atomic.Int64
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		queueName := fmt.Sprint("bench-", nextQueue.Add(1))
+		take := func() (valueobject.Message, error) { return message, nil }
+
+		for pb.Next() {
+			if _, err := waiter.WaitMessage(queueName, take, time.Minute, ctx); err != nil {
+				b.Fatal(err)
+			}
+
+			waiter.Notify(queueName)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+)
+
+var ErrNoDeadLetterQueue = errors.New("queue has no dead-letter queue")
+
+type DeadLetterRedriver struct {
+	broker *model.Broker
+	waiter *model.Waiter
+}
+
+func NewDeadLetterRedriver(broker *model.Broker, waiter *model.Waiter) *DeadLetterRedriver {
+	return &DeadLetterRedriver{broker: broker, waiter: waiter}
+}
+
+// Redrive moves up to maxMessages (all if zero) messages from the dead-letter queue of the queue back into it,
+// keeping their order. It stops early when the queue is full and returns the number of moved messages.
+func (p *DeadLetterRedriver) Redrive(queueName string, maxMessages int) (int, error) {
+	const op = "DeadLetterRedriver.Redrive"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	policy := queue.DeadLetterPolicy()
+	if policy.MaxDeliveries == 0 {
+		return 0, fmt.Errorf("%s: %w", op, ErrNoDeadLetterQueue)
+	}
+
+	deadLetterQueue, err := p.broker.GetQueue(policy.QueueName)
+	if errors.Is(err, model.ErrQueueNotFound) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	moved := 0
+
+	for maxMessages == 0 || moved < maxMessages {
+		receipt := rand.Text()
+
+		message, err := deadLetterQueue.ReserveMessage(receipt)
+		if errors.Is(err, model.ErrMessageNotFound) {
+			break
+		}
+
+		if err != nil {
+			return moved, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := moveMessage(p.broker, p.waiter, message, queueName); err != nil {
+			if releaseErr := deadLetterQueue.ReleaseMessage(receipt); releaseErr != nil {
+				return moved, fmt.Errorf("%s: %w", op, releaseErr)
+			}
+
+			if errors.Is(err, model.ErrQueueIsFull) || errors.Is(err, model.ErrQueueBytesExceeded) {
+				break
+			}
+
+			return moved, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := deadLetterQueue.AckMessage(receipt); err != nil {
+			return moved, fmt.Errorf("%s: %w", op, err)
+		}
+
+		moved++
+	}
+
+	return moved, nil
+}
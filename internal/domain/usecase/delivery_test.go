@@ -0,0 +1,237 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/infrastructure/memory"
+	"go-test-task/internal/infrastructure/metrics"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDelivery() (*usecase.MessagePutter, *usecase.MessageGetter, *usecase.MessageAcker) {
+	queueRepo := memory.NewInMemoryQueue(1)
+	brokerRepo := memory.NewInMemoryBroker(1, queueRepo)
+	broker := model.NewBroker(model.BrokerConfig{
+		AutoCreate: true,
+		DefaultQueueConfig: func(string) model.QueueConfig {
+			return model.QueueConfig{Type: model.QueueTypeFIFO, OverflowPolicy: model.OverflowReject}
+		},
+	}, brokerRepo)
+	waiter := model.NewWaiter()
+	brokerMetrics := metrics.NewBrokerMetrics(metrics.NewRegistry())
+
+	return usecase.NewMessagePutter(broker, waiter, model.NewScheduler(queueRepo, waiter), brokerMetrics),
+		usecase.NewMessageGetter(broker, waiter, brokerMetrics),
+		usecase.NewMessageAcker(broker, waiter)
+}
+
+func Test_Delivery_PutRacingWithWaiterNeverStalls(t *testing.T) {
+	t.Parallel()
+
+	const pairs = 8
+
+	putter, getter, _ := newDelivery()
+	_, err := putter.Put("race", valueobject.Message{Content: "create"}, t.Context())
+	require.NoError(t, err)
+	_, _, err = getter.Get("race", 0, 0, t.Context())
+	require.NoError(t, err)
+
+	for round := range 1000 {
+		start := make(chan struct{})
+		got := make(chan error, pairs)
+
+		for i := range pairs {
+			go func() {
+				<-start
+				_, _, err := getter.Get("race", 5*time.Second, 0, t.Context())
+				got <- err
+			}()
+
+			go func() {
+				<-start
+				_, err := putter.Put("race", valueobject.Message{Content: fmt.Sprint(round, i)}, t.Context())
+				assert.NoError(t, err)
+			}()
+		}
+
+		close(start)
+
+		for range pairs {
+			select {
+			case err := <-got:
+				require.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatalf("round %d: waiter stalled while a message was in the queue", round)
+			}
+		}
+	}
+}
+
+func Test_Delivery_StressNoLossNoDuplicates(t *testing.T) {
+	t.Parallel()
+
+	const (
+		producers   = 8
+		perProducer = 500
+		consumers   = 16
+	)
+
+	putter, getter, acker := newDelivery()
+	_, err := putter.Put("stress", valueobject.Message{Content: "create"}, t.Context())
+	require.NoError(t, err)
+	_, _, err = getter.Get("stress", 0, 0, t.Context())
+	require.NoError(t, err)
+
+	var (
+		received sync.Map
+		total    atomic.Int64
+		wg       sync.WaitGroup
+	)
+
+	for p := range producers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range perProducer {
+				_, err := putter.Put("stress", valueobject.Message{Content: fmt.Sprintf("%d-%d", p, i)}, t.Context())
+				assert.NoError(t, err)
+
+				if rand.IntN(10) == 0 {
+					time.Sleep(time.Duration(rand.IntN(200)) * time.Microsecond)
+				}
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+
+	for range consumers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for total.Load() < producers*perProducer && time.Now().Before(deadline) {
+				// Short timeouts and cancellations make waiters leave while messages are handed over
+				ctx, cancel := context.WithTimeout(t.Context(), time.Duration(rand.IntN(3000))*time.Microsecond)
+				waitTimeout := time.Duration(rand.IntN(3000)) * time.Microsecond
+				visibilityTimeout := time.Duration(rand.IntN(2)) * time.Minute
+
+				message, receipt, err := getter.Get("stress", waitTimeout, visibilityTimeout, ctx)
+				cancel()
+
+				if err != nil {
+					assert.ErrorIs(t, err, model.ErrWaitTimeout)
+
+					continue
+				}
+
+				if receipt != "" {
+					assert.NoError(t, acker.Ack("stress", receipt))
+				}
+
+				_, isDuplicate := received.LoadOrStore(message.ID, struct{}{})
+				assert.False(t, isDuplicate, "duplicate %s", message.Content)
+				total.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int64(producers*perProducer), total.Load(), "messages lost or consumers stalled")
+}
+
+func Test_Delivery_ClosedStreamPutsBackMessageNotDone(t *testing.T) {
+	t.Parallel()
+
+	putter, getter, _ := newDelivery()
+
+	_, err := putter.Put("stream", valueobject.Message{Content: "kept"}, t.Context())
+	require.NoError(t, err)
+
+	stream, err := getter.Stream("stream", 0)
+	require.NoError(t, err)
+
+	received, err := stream.Next(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, "kept", received.Message.Content)
+
+	// The consumer left before it could send the message
+	stream.Close()
+
+	message, _, err := getter.Get("stream", 0, 0, t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "kept", message.Content)
+}
+
+// hookedQueueStorage calls afterPut once a message is stored.
+type hookedQueueStorage struct {
+	*memory.InMemoryQueue
+	afterPut func(queueName string)
+}
+
+func (r *hookedQueueStorage) PutMessageToEnd(queueName string, message valueobject.Message) error {
+	if err := r.InMemoryQueue.PutMessageToEnd(queueName, message); err != nil {
+		return err
+	}
+
+	r.afterPut(queueName)
+
+	return nil
+}
+
+func Test_Delivery_AckRacingWithDeadLetterMoveKeepsOneCopy(t *testing.T) {
+	t.Parallel()
+
+	queueRepo := &hookedQueueStorage{InMemoryQueue: memory.NewInMemoryQueue(1), afterPut: func(string) {}}
+	broker := model.NewBroker(model.BrokerConfig{
+		AutoCreate: true,
+		DefaultQueueConfig: func(queueName string) model.QueueConfig {
+			config := model.QueueConfig{Type: model.QueueTypeFIFO, OverflowPolicy: model.OverflowReject}
+			if queueName == "jobs" {
+				config.DeadLetterPolicy = model.DeadLetterPolicy{MaxDeliveries: 1, QueueName: "jobs.dlq"}
+			}
+
+			return config
+		},
+	}, memory.NewInMemoryBroker(1, queueRepo))
+	waiter := model.NewWaiter()
+	brokerMetrics := metrics.NewBrokerMetrics(metrics.NewRegistry())
+	putter := usecase.NewMessagePutter(broker, waiter, model.NewScheduler(queueRepo, waiter), brokerMetrics)
+	getter := usecase.NewMessageGetter(broker, waiter, brokerMetrics)
+	acker := usecase.NewMessageAcker(broker, waiter)
+
+	_, err := putter.Put("jobs", valueobject.Message{Content: "job"}, t.Context())
+	require.NoError(t, err)
+	_, receipt, err := getter.Get("jobs", 0, time.Minute, t.Context())
+	require.NoError(t, err)
+
+	// The consumer acks right after the copy lands in the dead-letter queue
+	acked := make(chan error, 1)
+	queueRepo.afterPut = func(queueName string) {
+		if queueName == "jobs.dlq" {
+			go func() { acked <- acker.Ack("jobs", receipt) }()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	nackErr := acker.Nack("jobs", receipt)
+	ackErr := <-acked
+
+	_, _, dlqErr := getter.Get("jobs.dlq", 0, 0, t.Context())
+	assert.True(t, (ackErr == nil) != (nackErr == nil), "either the ack or the move wins, ack: %v, nack: %v", ackErr, nackErr)
+	assert.Equal(t, nackErr == nil, dlqErr == nil, "the dead-letter queue holds a copy only of a moved message")
+}
@@ -0,0 +1,50 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+)
+
+// Drainer stops the broker from taking new work before shutdown, so in-flight requests end quickly.
+type Drainer struct {
+	broker *model.Broker
+	waiter *model.Waiter
+}
+
+func NewDrainer(broker *model.Broker, waiter *model.Waiter) *Drainer {
+	return &Drainer{broker: broker, waiter: waiter}
+}
+
+// Drain rejects new puts, wakes blocked puts and waiting consumers with ErrDraining and fails later ones with it.
+// Acks and nacks keep working, so consumers can settle messages they hold.
+func (p *Drainer) Drain() error {
+	const op = "Drainer.Drain"
+
+	p.broker.Drain()
+	p.waiter.Drain(model.ErrDraining)
+
+	queueNames, err := p.broker.ListQueues()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, queueName := range queueNames {
+		queue, err := p.broker.GetQueue(queueName)
+		if errors.Is(err, model.ErrQueueNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		queue.CancelBlockedPuts(model.ErrDraining)
+	}
+
+	return nil
+}
+
+func (p *Drainer) IsDraining() bool {
+	return p.broker.IsDraining()
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"go-test-task/internal/domain/model"
+	"log"
+	"time"
+)
+
+// ExpiredMessageSweeper deletes expired messages in the background.
+// Queues skip expired messages on their own, the sweep frees the memory and disk they take
+// and lets puts blocked by full queues use the room.
+type ExpiredMessageSweeper struct {
+	broker  *model.Broker
+	storage model.QueueStorage
+}
+
+func NewExpiredMessageSweeper(broker *model.Broker, storage model.QueueStorage) *ExpiredMessageSweeper {
+	return &ExpiredMessageSweeper{broker: broker, storage: storage}
+}
+
+func (s *ExpiredMessageSweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweep(); err != nil {
+				log.Println("ExpiredMessageSweeper.Run:", err)
+			}
+		}
+	}
+}
+
+func (s *ExpiredMessageSweeper) sweep() error {
+	deleted, err := s.storage.DeleteExpiredMessages()
+	if err != nil || deleted == 0 {
+		return err
+	}
+
+	queueNames, err := s.broker.ListQueues()
+	if err != nil {
+		return err
+	}
+
+	for _, queueName := range queueNames {
+		if queue, err := s.broker.GetQueue(queueName); err == nil {
+			queue.NotifyRoom()
+		}
+	}
+
+	return nil
+}
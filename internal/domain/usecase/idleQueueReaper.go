@@ -0,0 +1,39 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// IdleQueueReaper deletes idle queues in the background, so one-off queue names do not use up the queue limit.
+type IdleQueueReaper struct {
+	manager     *QueueManager
+	idleTimeout time.Duration
+}
+
+func NewIdleQueueReaper(manager *QueueManager, idleTimeout time.Duration) *IdleQueueReaper {
+	return &IdleQueueReaper{manager: manager, idleTimeout: idleTimeout}
+}
+
+// Run checks queues every quarter of the idle timeout, so a queue is deleted at most that late.
+func (s *IdleQueueReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(s.idleTimeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.manager.DeleteIdleQueues(s.idleTimeout)
+			if err != nil {
+				log.Println("IdleQueueReaper.Run:", err)
+			}
+
+			if len(deleted) > 0 {
+				log.Printf("IdleQueueReaper.Run: deleted idle queues %v", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"fmt"
+	"go-test-task/internal/domain/model"
+)
+
+type MessageAcker struct {
+	broker *model.Broker
+	waiter *model.Waiter
+}
+
+func NewMessageAcker(broker *model.Broker, waiter *model.Waiter) *MessageAcker {
+	return &MessageAcker{broker: broker, waiter: waiter}
+}
+
+func (p *MessageAcker) Ack(queueName, receipt string) error {
+	const op = "MessageAcker.Ack"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := queue.AckMessage(receipt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Nack returns a reserved message to its place in the queue for immediate redelivery
+// or to the dead-letter queue if it has used up its deliveries.
+func (p *MessageAcker) Nack(queueName, receipt string) error {
+	const op = "MessageAcker.Nack"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := releaseMessage(p.broker, p.waiter, queue, receipt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -2,45 +2,279 @@ package usecase
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"go-test-task/internal/domain/model"
 	"go-test-task/internal/domain/valueobject"
+	"sync"
 	"time"
 )
 
+// QueueWaitTimeout makes a get wait for the wait timeout configured for the queue.
+const QueueWaitTimeout time.Duration = -1
+
 type MessageGetter struct {
-	broker *model.Broker
-	waiter *model.Waiter
+	broker  *model.Broker
+	waiter  *model.Waiter
+	metrics Metrics
+}
+
+func NewMessageGetter(broker *model.Broker, waiter *model.Waiter, metrics Metrics) *MessageGetter {
+	return &MessageGetter{broker: broker, waiter: waiter, metrics: metrics}
 }
 
-func NewMessageGetter(broker *model.Broker, waiter *model.Waiter) *MessageGetter {
-	return &MessageGetter{broker: broker, waiter: waiter}
+// ReceivedMessage is a message handed to a consumer. Receipt is empty if the message was popped.
+type ReceivedMessage struct {
+	Message valueobject.Message
+	Receipt string
 }
 
-func (p *MessageGetter) Get(queueName string, waitTimeout time.Duration, ctx context.Context) (valueobject.Message, error) {
+// Get takes the first message. With a positive visibilityTimeout the message is only reserved:
+// it must be acknowledged by the returned receipt, otherwise it becomes visible again after the timeout.
+// A message is always reserved first, so it goes back to the queue if the consumer leaves during the hand-off.
+func (p *MessageGetter) Get(queueName string, waitTimeout, visibilityTimeout time.Duration, ctx context.Context) (valueobject.Message, string, error) {
 	const op = "MessageGetter.Get"
 
-	var res valueobject.Message
+	received, err := p.get(queueName, 1, waitTimeout, visibilityTimeout, ctx)
+	if err != nil {
+		return valueobject.Message{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return received[0].Message, received[0].Receipt, nil
+}
+
+// GetBatch takes up to maxMessages messages like Get. It waits only for the first one.
+func (p *MessageGetter) GetBatch(queueName string, maxMessages int, waitTimeout, visibilityTimeout time.Duration, ctx context.Context) ([]ReceivedMessage, error) {
+	const op = "MessageGetter.GetBatch"
+
+	received, err := p.get(queueName, maxMessages, waitTimeout, visibilityTimeout, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
+	return received, nil
+}
+
+// Pop takes the first message without a visibility timeout. Unlike Get it creates a missing queue
+// if auto-creation is enabled, so a consumer may wait before the first put, as on Redis lists.
+func (p *MessageGetter) Pop(queueName string, waitTimeout time.Duration, ctx context.Context) (valueobject.Message, error) {
+	const op = "MessageGetter.Pop"
+
+	if _, err := p.broker.GetOrCreateQueue(queueName); err != nil {
+		return valueobject.Message{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	received, err := p.get(queueName, 1, waitTimeout, 0, ctx)
+	if err != nil {
+		return valueobject.Message{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return received[0].Message, nil
+}
+
+func (p *MessageGetter) get(queueName string, maxMessages int, waitTimeout, visibilityTimeout time.Duration, ctx context.Context) ([]ReceivedMessage, error) {
 	queue, err := p.broker.GetQueue(queueName)
 	if err != nil {
-		return res, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
-	message, err := queue.GetMessage()
-	if err == nil {
-		return message, nil
+	if waitTimeout == QueueWaitTimeout {
+		waitTimeout = queue.Config().WaitTimeout
 	}
 
-	if !errors.Is(err, model.ErrMessageNotFound) {
-		return res, fmt.Errorf("%s: %w", op, err)
+	var received []ReceivedMessage
+
+	startedAt := time.Now()
+
+	// The whole batch is reserved in one take, so waiters that came later cannot get ahead of this one
+	_, err = p.waiter.WaitMessage(queueName, func() (valueobject.Message, error) {
+		for len(received) < maxMessages {
+			receipt := rand.Text()
+
+			message, err := queue.ReserveMessage(receipt)
+			if err != nil {
+				if len(received) > 0 {
+					break
+				}
+
+				return message, err
+			}
+
+			received = append(received, ReceivedMessage{Message: message, Receipt: receipt})
+		}
+
+		return received[0].Message, nil
+	}, waitTimeout, ctx)
+	if errors.Is(err, model.ErrWaitTimeout) {
+		p.metrics.ObserveWaitTimeout(queueName, time.Since(startedAt))
 	}
 
-	message, err = p.waiter.WaitMessage(queueName, waitTimeout, ctx)
 	if err != nil {
-		return res, fmt.Errorf("%s: %w", op, err)
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		for _, r := range received {
+			if err := queue.ReleaseMessage(r.Receipt); err != nil {
+				return nil, err
+			}
+		}
+
+		p.waiter.Notify(queueName)
+		p.metrics.ObserveWaitTimeout(queueName, time.Since(startedAt))
+
+		return nil, model.ErrWaitTimeout
 	}
 
+	p.metrics.ObserveTake(queueName, len(received), time.Since(startedAt))
+
+	if visibilityTimeout <= 0 {
+		for i := range received {
+			if err := queue.AckMessage(received[i].Receipt); err != nil {
+				return nil, err
+			}
+
+			received[i].Receipt = ""
+		}
+
+		return received, nil
+	}
+
+	// Acknowledged or released message is already gone by then, so the release just fails
+	for _, r := range received {
+		time.AfterFunc(visibilityTimeout, func() {
+			releaseMessage(p.broker, p.waiter, queue, r.Receipt)
+		})
+	}
+
+	return received, nil
+}
+
+// MessageStream is a persistent consumer of a queue, see MessageGetter.Stream. It is used by one goroutine.
+type MessageStream struct {
+	getter            *MessageGetter
+	queue             *model.Queue
+	stream            *model.Stream
+	visibilityTimeout time.Duration
+	// receipts of messages taken for the stream under the waiter lock, by message ID
+	receipts map[string]string
+	mu       sync.Mutex
+	// pending is the receipt of the message returned by Next and not yet Done
+	pending string
+}
+
+// Stream registers a consumer staying in the line of waiters of the queue, so it takes turns with other consumers.
+// Messages are handed over like by Get, with a positive visibilityTimeout they must be acknowledged by the receipt.
+func (p *MessageGetter) Stream(queueName string, visibilityTimeout time.Duration) (*MessageStream, error) {
+	const op = "MessageGetter.Stream"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s := &MessageStream{getter: p, queue: queue, visibilityTimeout: visibilityTimeout, receipts: make(map[string]string)}
+
+	s.stream, err = p.waiter.Stream(queueName, s.take)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s, nil
+}
+
+// Next waits for the next message until ctx is done. The consumer keeps its place in the line meanwhile,
+// so Next can be called again after a timeout. Every message must be passed to Done before the next call.
+func (s *MessageStream) Next(ctx context.Context) (ReceivedMessage, error) {
+	const op = "MessageStream.Next"
+
+	startedAt := time.Now()
+
+	message, err := s.stream.Next(ctx)
+	if err != nil {
+		return ReceivedMessage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.pending = s.popReceipt(message.ID)
+	s.getter.metrics.ObserveTake(s.queue.Name(), 1, time.Since(startedAt))
+
+	received := ReceivedMessage{Message: message}
+	if s.visibilityTimeout > 0 {
+		received.Receipt = s.pending
+	}
+
+	return received, nil
+}
+
+// Done ends the hand-off of the message returned by Next. A message that was not sent goes back to the queue.
+func (s *MessageStream) Done(isSent bool) error {
+	const op = "MessageStream.Done"
+
+	receipt := s.pending
+	s.pending = ""
+
+	if !isSent {
+		s.putBack(receipt)
+
+		return nil
+	}
+
+	if s.visibilityTimeout <= 0 {
+		if err := s.queue.AckMessage(receipt); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	}
+
+	time.AfterFunc(s.visibilityTimeout, func() {
+		releaseMessage(s.getter.broker, s.getter.waiter, s.queue, receipt)
+	})
+
+	return nil
+}
+
+// Close takes the consumer out of the line and puts back the message taken for it and not received,
+// as well as the one received by Next and not passed to Done.
+func (s *MessageStream) Close() {
+	if s.pending != "" {
+		s.putBack(s.pending)
+		s.pending = ""
+	}
+
+	if message, ok := s.stream.Close(); ok {
+		s.putBack(s.popReceipt(message.ID))
+	}
+}
+
+func (s *MessageStream) take() (valueobject.Message, error) {
+	receipt := rand.Text()
+
+	message, err := s.queue.ReserveMessage(receipt)
+	if err != nil {
+		return message, err
+	}
+
+	s.mu.Lock()
+	s.receipts[message.ID] = receipt
+	s.mu.Unlock()
+
 	return message, nil
 }
+
+func (s *MessageStream) popReceipt(messageID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt := s.receipts[messageID]
+	delete(s.receipts, messageID)
+
+	return receipt
+}
+
+func (s *MessageStream) putBack(receipt string) {
+	if err := s.queue.ReleaseMessage(receipt); err == nil {
+		s.getter.waiter.Notify(s.queue.Name())
+	}
+}
@@ -1,53 +1,149 @@
 package usecase
 
 import (
-	"errors"
+	"context"
+	"crypto/rand"
 	"fmt"
 	"go-test-task/internal/domain/model"
 	"go-test-task/internal/domain/valueobject"
+	"time"
 )
 
 type MessagePutter struct {
-	broker *model.Broker
-	waiter *model.Waiter
+	broker    *model.Broker
+	waiter    *model.Waiter
+	scheduler *model.Scheduler
+	metrics   Metrics
 }
 
-func NewMessagePutter(broker *model.Broker, waiter *model.Waiter) *MessagePutter {
-	return &MessagePutter{broker: broker, waiter: waiter}
+func NewMessagePutter(broker *model.Broker, waiter *model.Waiter, scheduler *model.Scheduler, metrics Metrics) *MessagePutter {
+	return &MessagePutter{broker: broker, waiter: waiter, scheduler: scheduler, metrics: metrics}
 }
 
-func (p *MessagePutter) Put(queueName string, message valueobject.Message) error {
+// Put stores the message under a new server-assigned ID and returns the ID.
+// A message with a future DeliverAt is invisible to consumers until then.
+// A put to a full queue with the block overflow policy waits for room until ctx is done.
+func (p *MessagePutter) Put(queueName string, message valueobject.Message, ctx context.Context) (string, error) {
 	const op = "MessagePutter.Put"
 
-	queue, err := p.getQueue(queueName)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if p.broker.IsDraining() {
+		p.observeRejected(queueName, model.ErrDraining)
+
+		return "", fmt.Errorf("%s: %w", op, model.ErrDraining)
 	}
 
-	if p.waiter.Notify(queue.Name(), message) {
-		return nil
+	// A put over the byte limit does not create the queue
+	if err := p.broker.CheckBytes(message.Size()); err != nil {
+		p.observeRejected(queueName, err)
+
+		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = queue.PutMessage(message)
+	queue, err := p.broker.GetOrCreateQueue(queueName)
 	if err != nil {
-		return fmt.Errorf("%w: %s", err, op)
+		p.observeRejected(queueName, err)
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	message.ID = rand.Text()
+	message.EnqueuedAt = now.UTC()
+	message.Deliveries = 0
+
+	err = queue.PutMessage(message, ctx)
+	if err != nil {
+		p.observeRejected(queueName, err)
+
+		return "", fmt.Errorf("%w: %s", err, op)
+	}
+
+	p.metrics.ObservePut(queueName, 1)
+
+	if !message.IsDue(now) {
+		p.scheduler.Schedule(message.DeliverAt)
+
+		return message.ID, nil
 	}
 
-	return nil
+	p.waiter.Notify(queue.Name())
+
+	return message.ID, nil
 }
 
-func (p *MessagePutter) getQueue(queueName string) (*model.Queue, error) {
-	queue, err := p.broker.GetQueue(queueName)
+// PutBatch stores all the messages in order or none of them and returns their IDs.
+func (p *MessagePutter) PutBatch(queueName string, messages []valueobject.Message, ctx context.Context) ([]string, error) {
+	const op = "MessagePutter.PutBatch"
+
+	if p.broker.IsDraining() {
+		p.observeRejected(queueName, model.ErrDraining)
+
+		return nil, fmt.Errorf("%s: %w", op, model.ErrDraining)
+	}
+
+	size := 0
+	for _, message := range messages {
+		size += message.Size()
+	}
+
+	if err := p.broker.CheckBytes(size); err != nil {
+		p.observeRejected(queueName, err)
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	queue, err := p.broker.GetOrCreateQueue(queueName)
 	if err != nil {
-		if !errors.Is(err, model.ErrQueueNotFound) {
-			return nil, err
-		}
+		p.observeRejected(queueName, err)
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	batch := make([]valueobject.Message, len(messages))
+	messageIDs := make([]string, len(messages))
+
+	for i, message := range messages {
+		message.ID = rand.Text()
+		message.EnqueuedAt = now.UTC()
+		message.Deliveries = 0
+
+		batch[i] = message
+		messageIDs[i] = message.ID
+	}
+
+	if err := queue.PutMessages(batch, ctx); err != nil {
+		p.observeRejected(queueName, err)
 
-		queue, err = p.broker.CreateQueue(queueName)
-		if err != nil {
-			return nil, err
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.metrics.ObservePut(queueName, len(batch))
+
+	isNotifyNeeded := false
+
+	for _, message := range batch {
+		if message.IsDue(now) {
+			isNotifyNeeded = true
+		} else {
+			p.scheduler.Schedule(message.DeliverAt)
 		}
 	}
 
-	return queue, nil
+	if isNotifyNeeded {
+		p.waiter.Notify(queue.Name())
+	}
+
+	return messageIDs, nil
+}
+
+// observeRejected labels the rejection with the queue only if the broker holds it.
+func (p *MessagePutter) observeRejected(queueName string, err error) {
+	if _, getErr := p.broker.GetQueue(queueName); getErr != nil {
+		queueName = ""
+	}
+
+	p.metrics.ObservePutRejected(queueName, err)
 }
@@ -0,0 +1,45 @@
+package usecase
+
+import (
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/valueobject"
+)
+
+// releaseMessage makes a reserved message visible again, or moves it to the dead-letter queue
+// when it has used up its deliveries. The message is released as usual if the dead-letter queue can't take it.
+func releaseMessage(broker *model.Broker, waiter *model.Waiter, queue *model.Queue, receipt string) error {
+	policy := queue.DeadLetterPolicy()
+
+	isMoved, err := queue.MoveReservedMessage(receipt, func(message valueobject.Message) bool {
+		return policy.IsExceeded(message) && moveMessage(broker, waiter, message, policy.QueueName) == nil
+	})
+	if err != nil || isMoved {
+		return err
+	}
+
+	if err := queue.ReleaseMessage(receipt); err != nil {
+		return err
+	}
+
+	waiter.Notify(queue.Name())
+
+	return nil
+}
+
+// moveMessage is not checked against the byte limit of the broker, the message only changes queues.
+func moveMessage(broker *model.Broker, waiter *model.Waiter, message valueobject.Message, queueName string) error {
+	queue, err := broker.GetOrCreateQueue(queueName)
+	if err != nil {
+		return err
+	}
+
+	message.Deliveries = 0
+
+	if err := queue.MoveMessage(message); err != nil {
+		return err
+	}
+
+	waiter.Notify(queue.Name())
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package usecase
+
+import "time"
+
+// Metrics is told what happens to messages of queues.
+type Metrics interface {
+	ObservePut(queueName string, count int)
+	// ObservePutRejected gets an empty queueName if the queue is not known to the broker,
+	// so clients can not add series with any name.
+	ObservePutRejected(queueName string, err error)
+	ObserveTake(queueName string, count int, wait time.Duration)
+	ObserveWaitTimeout(queueName string, wait time.Duration)
+	// ForgetQueue drops the series of a deleted queue.
+	ForgetQueue(queueName string)
+}
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"time"
+)
+
+type QueueManager struct {
+	broker  *model.Broker
+	waiter  *model.Waiter
+	metrics Metrics
+}
+
+type QueueStats struct {
+	model.QueueStats
+	Waiters     int
+	BlockedPuts int
+}
+
+func NewQueueManager(broker *model.Broker, waiter *model.Waiter, metrics Metrics) *QueueManager {
+	return &QueueManager{broker: broker, waiter: waiter, metrics: metrics}
+}
+
+func (p *QueueManager) ListQueues() ([]string, error) {
+	const op = "QueueManager.ListQueues"
+
+	queueNames, err := p.broker.ListQueues()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return queueNames, nil
+}
+
+func (p *QueueManager) GetConfig(queueName string) (model.QueueConfig, error) {
+	const op = "QueueManager.GetConfig"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return model.QueueConfig{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return queue.Config(), nil
+}
+
+// DefaultConfig returns the config the queue gets when it is created on put.
+func (p *QueueManager) DefaultConfig(queueName string) model.QueueConfig {
+	return p.broker.DefaultConfig(queueName)
+}
+
+// Configure creates the queue with the config or reconfigures the existing one.
+// The dead-letter queue of the config is created too, so messages can be moved there
+// when queues are not created on put.
+func (p *QueueManager) Configure(queueName string, config model.QueueConfig) error {
+	const op = "QueueManager.Configure"
+
+	if _, err := p.broker.ConfigureQueue(queueName, config); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if config.DeadLetterPolicy.MaxDeliveries == 0 {
+		return nil
+	}
+
+	_, err := p.broker.GetQueue(config.DeadLetterPolicy.QueueName)
+	if errors.Is(err, model.ErrQueueNotFound) {
+		_, err = p.broker.CreateQueue(config.DeadLetterPolicy.QueueName)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (p *QueueManager) GetStats(queueName string) (QueueStats, error) {
+	const op = "QueueManager.GetStats"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	stats, err := queue.Stats()
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return QueueStats{QueueStats: stats, Waiters: p.waiter.CountWaiters(queueName), BlockedPuts: queue.CountBlockedPuts()}, nil
+}
+
+// Purge deletes all messages of the queue and returns their number. Receipts of reserved messages stop working.
+func (p *QueueManager) Purge(queueName string) (int, error) {
+	const op = "QueueManager.Purge"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	purged, err := queue.Purge()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return purged, nil
+}
+
+// Delete purges and deletes the queue and wakes its waiters and blocked puts with ErrQueueDeleted.
+// A later put creates the queue anew, e.g. a put to a deleted queue still subscribed to a topic.
+func (p *QueueManager) Delete(queueName string) error {
+	const op = "QueueManager.Delete"
+
+	queue, err := p.broker.GetQueue(queueName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := p.delete(queue); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteIdleQueues deletes queues that have had no puts or takes for idleTimeout and hold no messages
+// and no waiters, except the ones configured to be kept. It returns names of the deleted queues.
+func (p *QueueManager) DeleteIdleQueues(idleTimeout time.Duration) ([]string, error) {
+	const op = "QueueManager.DeleteIdleQueues"
+
+	queueNames, err := p.broker.ListQueues()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var deleted []string
+
+	for _, queueName := range queueNames {
+		queue, err := p.broker.GetQueue(queueName)
+		if errors.Is(err, model.ErrQueueNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return deleted, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if !p.isIdle(queue, idleTimeout) {
+			continue
+		}
+
+		// A put may have come after the check, so the queue is closed only if it is still empty and never purged
+		isClosed, err := queue.CloseIfEmpty()
+		if err != nil {
+			return deleted, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if !isClosed {
+			continue
+		}
+
+		if err := p.remove(queue); err != nil {
+			return deleted, fmt.Errorf("%s: %w", op, err)
+		}
+
+		deleted = append(deleted, queueName)
+	}
+
+	return deleted, nil
+}
+
+func (p *QueueManager) isIdle(queue *model.Queue, idleTimeout time.Duration) bool {
+	return !queue.Config().KeepIdle && time.Since(queue.LastActiveAt()) >= idleTimeout && p.waiter.CountWaiters(queue.Name()) == 0
+}
+
+func (p *QueueManager) delete(queue *model.Queue) error {
+	// Puts are stopped first, otherwise the purge would let them in
+	queue.Close()
+
+	if _, err := queue.Purge(); err != nil {
+		return err
+	}
+
+	return p.remove(queue)
+}
+
+// remove deletes the closed queue from the broker and wakes its waiters.
+func (p *QueueManager) remove(queue *model.Queue) error {
+	if err := p.broker.DeleteQueue(queue.Name()); err != nil {
+		return err
+	}
+
+	p.waiter.Cancel(queue.Name(), model.ErrQueueDeleted)
+	p.metrics.ForgetQueue(queue.Name())
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package usecase_test
+
+import (
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/usecase"
+	"go-test-task/internal/domain/valueobject"
+	"go-test-task/internal/infrastructure/memory"
+	"go-test-task/internal/infrastructure/metrics"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManagement() (*model.Broker, *usecase.MessagePutter, *usecase.MessageGetter, *usecase.QueueManager) {
+	queueRepo := memory.NewInMemoryQueue(0)
+	broker := model.NewBroker(model.BrokerConfig{
+		AutoCreate: true,
+		DefaultQueueConfig: func(string) model.QueueConfig {
+			return model.QueueConfig{Type: model.QueueTypeFIFO, OverflowPolicy: model.OverflowReject}
+		},
+	}, memory.NewInMemoryBroker(0, queueRepo))
+	waiter := model.NewWaiter()
+	brokerMetrics := metrics.NewBrokerMetrics(metrics.NewRegistry())
+
+	return broker,
+		usecase.NewMessagePutter(broker, waiter, model.NewScheduler(queueRepo, waiter), brokerMetrics),
+		usecase.NewMessageGetter(broker, waiter, brokerMetrics),
+		usecase.NewQueueManager(broker, waiter, brokerMetrics)
+}
+
+func Test_QueueManager_DeletingIdleQueuesNeverLosesPuts(t *testing.T) {
+	t.Parallel()
+
+	_, putter, getter, manager := newManagement()
+
+	stored := 0
+
+	for round := range 500 {
+		var wg sync.WaitGroup
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := putter.Put("idle", valueobject.Message{Content: fmt.Sprint(round)}, t.Context())
+			if err == nil {
+				stored++
+			} else {
+				assert.ErrorIs(t, err, model.ErrQueueDeleted)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			_, err := manager.DeleteIdleQueues(0)
+			assert.NoError(t, err)
+		}()
+
+		wg.Wait()
+	}
+
+	taken := 0
+
+	for {
+		_, _, err := getter.Get("idle", 0, 0, t.Context())
+		if errors.Is(err, model.ErrQueueNotFound) || errors.Is(err, model.ErrWaitTimeout) {
+			break
+		}
+
+		require.NoError(t, err)
+		taken++
+	}
+
+	assert.Positive(t, stored)
+	assert.Equal(t, stored, taken, "every acknowledged put is kept")
+}
+
+func Test_QueueManager_DeletedQueueRejectsPutsOfItsHolders(t *testing.T) {
+	t.Parallel()
+
+	broker, putter, getter, manager := newManagement()
+
+	_, err := putter.Put("held", valueobject.Message{Content: "gone"}, t.Context())
+	require.NoError(t, err)
+
+	queue, err := broker.GetQueue("held")
+	require.NoError(t, err)
+
+	deleted, err := manager.DeleteIdleQueues(0)
+	require.NoError(t, err)
+	assert.Empty(t, deleted, "a queue with messages is not idle")
+
+	require.NoError(t, manager.Delete("held"))
+	assert.ErrorIs(t, queue.PutMessage(valueobject.Message{Content: "late"}, t.Context()), model.ErrQueueDeleted)
+
+	_, err = putter.Put("held", valueobject.Message{Content: "new"}, t.Context())
+	require.NoError(t, err)
+
+	message, _, err := getter.Get("held", 0, 0, t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "new", message.Content, "the late put doesn't come back in the recreated queue")
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/valueobject"
+)
+
+type TopicPublisher struct {
+	broker     *model.Broker
+	topics     model.TopicStorage
+	putter     *MessagePutter
+	fullPolicy model.FullSubscriberPolicy
+}
+
+// PublishResult maps subscriber queue names to IDs of the put copies,
+// Skipped lists full subscribers and the ones whose queue is gone and can't be created on put.
+type PublishResult struct {
+	MessageIDs map[string]string
+	Skipped    []string
+}
+
+func NewTopicPublisher(broker *model.Broker, topics model.TopicStorage, putter *MessagePutter, fullPolicy model.FullSubscriberPolicy) *TopicPublisher {
+	return &TopicPublisher{broker: broker, topics: topics, putter: putter, fullPolicy: fullPolicy}
+}
+
+// Publish puts a copy of the message to every subscriber queue.
+// With the reject policy subscribers and the byte limit of the broker are checked for room first, so the message
+// is put to none of them if one is full. A subscriber filled by a concurrent put after the check still fails the publish.
+// With the skip policy subscribers without room for the message, bytes included, are skipped.
+func (p *TopicPublisher) Publish(topicName string, message valueobject.Message, ctx context.Context) (PublishResult, error) {
+	const op = "TopicPublisher.Publish"
+
+	subscribers, err := p.topics.GetSubscribers(topicName)
+	if err != nil {
+		return PublishResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if p.fullPolicy == model.FullSubscriberReject {
+		if err := p.checkRoom(subscribers, message.Size()); err != nil {
+			return PublishResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	result := PublishResult{MessageIDs: make(map[string]string, len(subscribers))}
+
+	for _, queueName := range subscribers {
+		messageID, err := p.putter.Put(queueName, message, ctx)
+		if isNoRoom(err) && p.fullPolicy == model.FullSubscriberSkip || errors.Is(err, model.ErrQueueNotFound) {
+			result.Skipped = append(result.Skipped, queueName)
+
+			continue
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", op, err)
+		}
+
+		result.MessageIDs[queueName] = messageID
+	}
+
+	return result, nil
+}
+
+func (p *TopicPublisher) checkRoom(subscribers []string, size int) error {
+	copies := 0
+
+	for _, queueName := range subscribers {
+		queue, err := p.broker.GetOrCreateQueue(queueName)
+		if errors.Is(err, model.ErrQueueNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		copies++
+
+		// A full queue that drops messages still takes the copy
+		policy := queue.Config().OverflowPolicy
+		if policy == model.OverflowDropOldest || policy == model.OverflowDropNewest {
+			continue
+		}
+
+		isFull, err := queue.IsFull(size)
+		if err != nil {
+			return err
+		}
+
+		if isFull {
+			return fmt.Errorf("%w: %s", model.ErrSubscriberIsFull, queueName)
+		}
+	}
+
+	return p.broker.CheckBytes(copies * size)
+}
+
+func isNoRoom(err error) bool {
+	return errors.Is(err, model.ErrQueueIsFull) ||
+		errors.Is(err, model.ErrQueueBytesExceeded) ||
+		errors.Is(err, model.ErrBrokerBytesExceeded)
+}
@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"fmt"
+	"go-test-task/internal/domain/model"
+)
+
+type TopicSubscriber struct {
+	broker *model.Broker
+	topics model.TopicStorage
+}
+
+func NewTopicSubscriber(broker *model.Broker, topics model.TopicStorage) *TopicSubscriber {
+	return &TopicSubscriber{broker: broker, topics: topics}
+}
+
+// Subscribe creates the queue if needed and subscribes it to the topic, creating the topic as well.
+func (p *TopicSubscriber) Subscribe(topicName, queueName string) error {
+	const op = "TopicSubscriber.Subscribe"
+
+	if _, err := p.broker.GetOrCreateQueue(queueName); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := p.topics.Subscribe(topicName, queueName); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Unsubscribe keeps the queue and its messages. The topic is gone with its last subscriber.
+func (p *TopicSubscriber) Unsubscribe(topicName, queueName string) error {
+	const op = "TopicSubscriber.Unsubscribe"
+
+	if err := p.topics.Unsubscribe(topicName, queueName); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (p *TopicSubscriber) GetSubscribers(topicName string) ([]string, error) {
+	const op = "TopicSubscriber.GetSubscribers"
+
+	subscribers, err := p.topics.GetSubscribers(topicName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return subscribers, nil
+}
@@ -1,9 +1,55 @@
 package valueobject
 
+import "time"
+
 type Message struct {
-	Content string `json:"message"`
+	ID      string `json:"id,omitempty"`
+	Content string `json:"message,omitempty"`
+	// Body holds the content of a message put as raw bytes of ContentType instead of Content.
+	Body        []byte            `json:"body,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	Priority    int               `json:"priority,omitempty"`
+	EnqueuedAt  time.Time         `json:"enqueued_at,omitzero"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`
+	DeliverAt   time.Time         `json:"deliver_at,omitzero"`
+	Deliveries  int               `json:"deliveries,omitempty"`
 }
 
 func (m Message) IsValid() bool {
-	return m.Content != ""
+	// A message has either the content or the raw body
+	if (m.Content == "") == (len(m.Body) == 0) {
+		return false
+	}
+
+	for key := range m.Attributes {
+		if key == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Size is the number of bytes of the content or the body and the attributes.
+func (m Message) Size() int {
+	size := len(m.Content) + len(m.Body)
+	for key, value := range m.Attributes {
+		size += len(key) + len(value)
+	}
+
+	return size
+}
+
+// IsRaw tells the message was put as raw bytes and is handed out the same way.
+func (m Message) IsRaw() bool {
+	return len(m.Body) > 0
+}
+
+func (m Message) IsExpired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
+
+func (m Message) IsDue(now time.Time) bool {
+	return !now.Before(m.DeliverAt)
 }
@@ -0,0 +1,108 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test-task/internal/domain/model"
+	"sync"
+)
+
+// FileBroker records created queues with their configs in the log and recreates them in the wrapped storage on start.
+type FileBroker struct {
+	log     *Log
+	storage model.BrokerStorage
+	mu      sync.Mutex
+}
+
+// NewFileBroker recreates logged queues, a queue logged without a config gets the default one.
+func NewFileBroker(log *Log, storage model.BrokerStorage, defaultConfig func(queueName string) model.QueueConfig) (*FileBroker, error) {
+	for queueName, data := range log.Queues() {
+		config := defaultConfig(queueName)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &config); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := storage.CreateQueue(queueName, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileBroker{log: log, storage: storage}, nil
+}
+
+func (r *FileBroker) CreateQueue(queueName string, config model.QueueConfig) (*model.Queue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queue, err := r.storage.GetQueue(queueName)
+	if err == nil {
+		return queue, nil
+	}
+
+	if !errors.Is(err, model.ErrQueueNotFound) {
+		return nil, err
+	}
+
+	if err := r.logQueue(queueName, config); err != nil {
+		return nil, err
+	}
+
+	return r.storage.CreateQueue(queueName, config)
+}
+
+func (r *FileBroker) UpdateQueueConfig(queueName string, config model.QueueConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.storage.GetQueue(queueName); err != nil {
+		return err
+	}
+
+	if err := r.logQueue(queueName, config); err != nil {
+		return err
+	}
+
+	return r.storage.UpdateQueueConfig(queueName, config)
+}
+
+func (r *FileBroker) GetQueue(queueName string) (*model.Queue, error) {
+	return r.storage.GetQueue(queueName)
+}
+
+func (r *FileBroker) CountQueues() (int, error) {
+	return r.storage.CountQueues()
+}
+
+func (r *FileBroker) CountBytes() (int, error) {
+	return r.storage.CountBytes()
+}
+
+func (r *FileBroker) ListQueues() ([]string, error) {
+	return r.storage.ListQueues()
+}
+
+func (r *FileBroker) DeleteQueue(queueName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.storage.GetQueue(queueName); err != nil {
+		return err
+	}
+
+	if err := r.log.DeleteQueue(queueName); err != nil {
+		return err
+	}
+
+	return r.storage.DeleteQueue(queueName)
+}
+
+func (r *FileBroker) logQueue(queueName string, config model.QueueConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return r.log.CreateQueue(queueName, data)
+}
@@ -0,0 +1,524 @@
+package file
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const segmentExt = ".log"
+
+var ErrUnknownSyncPolicy = errors.New("unknown sync policy")
+
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"
+	SyncInterval SyncPolicy = "interval"
+	SyncNever    SyncPolicy = "never"
+)
+
+type Options struct {
+	SegmentSize  int64
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+}
+
+// Entry is a live message found in the log on open.
+type Entry struct {
+	Seq       uint64
+	QueueName string
+	Data      []byte
+}
+
+// Subscription is a queue subscribed to a topic.
+type Subscription struct {
+	TopicName string
+	QueueName string
+}
+
+type segment struct {
+	id       uint64
+	firstSeq uint64
+	live     int
+}
+
+// Log is an append-only write-ahead log split into numbered segment files.
+// Only the last segment is written to. A new segment starts with a create record for every known queue,
+// and subscription, so a head segment whose messages are all deleted can be removed without losing state.
+type Log struct {
+	dir        string
+	options    Options
+	segments   []*segment
+	active     *os.File
+	activeSize int64
+	// queues holds the logged config of every queue.
+	queues map[string][]byte
+	// subscriptions are kept in the order they were made.
+	subscriptions []Subscription
+	nextSeq       uint64
+	recovered     []Entry
+	stopSync      chan struct{}
+	syncDone      chan struct{}
+	mu            sync.Mutex
+}
+
+func OpenLog(dir string, options Options) (*Log, error) {
+	switch options.Sync {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if options.SyncInterval <= 0 {
+			return nil, fmt.Errorf("%w: interval must be positive", ErrUnknownSyncPolicy)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSyncPolicy, options.Sync)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, options: options, queues: make(map[string][]byte), nextSeq: 1}
+
+	if err := l.recover(); err != nil {
+		return nil, err
+	}
+
+	if l.options.Sync == SyncInterval {
+		l.stopSync = make(chan struct{})
+		l.syncDone = make(chan struct{})
+
+		go l.syncLoop()
+	}
+
+	return l, nil
+}
+
+// Queues returns configs of all queues known to the log by queue name.
+// A config is empty for a queue logged before queue configs were.
+func (l *Log) Queues() map[string][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return maps.Clone(l.queues)
+}
+
+// Messages returns the live messages recovered on open in the order they were put.
+func (l *Log) Messages() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.recovered
+	l.recovered = nil
+
+	return entries
+}
+
+// Subscriptions returns all subscriptions known to the log.
+func (l *Log) Subscriptions() []Subscription {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return slices.Clone(l.subscriptions)
+}
+
+// CreateQueue records the queue with its config, a queue created again gets the new config.
+func (l *Log) CreateQueue(queueName string, config []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(record{op: opCreateQueue, queueName: queueName, data: config}); err != nil {
+		return err
+	}
+
+	l.queues[queueName] = config
+
+	return nil
+}
+
+// DeleteQueue forgets the queue. Its messages are expected to be purged first.
+func (l *Log) DeleteQueue(queueName string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(record{op: opDeleteQueue, queueName: queueName}); err != nil {
+		return err
+	}
+
+	delete(l.queues, queueName)
+
+	return nil
+}
+
+// PurgeQueue deletes all messages of the queue with one record. seqs are the live messages of the queue,
+// the log does not index messages by queue.
+func (l *Log) PurgeQueue(queueName string, seqs []uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(record{op: opPurgeQueue, seq: l.nextSeq, queueName: queueName}); err != nil {
+		return err
+	}
+
+	for _, seq := range seqs {
+		l.segmentOf(seq).live--
+	}
+
+	return l.compact()
+}
+
+func (l *Log) Subscribe(topicName, queueName string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(record{op: opSubscribe, queueName: topicName, data: []byte(queueName)}); err != nil {
+		return err
+	}
+
+	l.addSubscription(Subscription{TopicName: topicName, QueueName: queueName})
+
+	return nil
+}
+
+func (l *Log) Unsubscribe(topicName, queueName string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(record{op: opUnsubscribe, queueName: topicName, data: []byte(queueName)}); err != nil {
+		return err
+	}
+
+	l.deleteSubscription(Subscription{TopicName: topicName, QueueName: queueName})
+
+	return nil
+}
+
+func (l *Log) PutMessage(queueName string, data []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seq := l.nextSeq
+	if err := l.append(record{op: opPutMessage, seq: seq, queueName: queueName, data: data}); err != nil {
+		return 0, err
+	}
+
+	l.nextSeq++
+	l.segments[len(l.segments)-1].live++
+
+	return seq, nil
+}
+
+func (l *Log) DeleteMessage(queueName string, seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(record{op: opDeleteMessage, seq: seq, queueName: queueName}); err != nil {
+		return err
+	}
+
+	l.segmentOf(seq).live--
+
+	return l.compact()
+}
+
+// Sync flushes the active segment to disk whatever the sync policy.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.active.Sync()
+}
+
+func (l *Log) Close() error {
+	if l.stopSync != nil {
+		close(l.stopSync)
+		<-l.syncDone
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.active.Sync(); err != nil {
+		l.active.Close()
+
+		return err
+	}
+
+	return l.active.Close()
+}
+
+func (l *Log) append(rec record) error {
+	if l.options.SegmentSize > 0 && l.activeSize >= l.options.SegmentSize {
+		if err := l.roll(); err != nil {
+			return err
+		}
+	}
+
+	return l.write(rec)
+}
+
+func (l *Log) write(rec record) error {
+	frame := rec.encode()
+
+	n, err := l.active.Write(frame)
+	l.activeSize += int64(n)
+
+	if err != nil {
+		return err
+	}
+
+	if l.options.Sync == SyncAlways {
+		return l.active.Sync()
+	}
+
+	return nil
+}
+
+func (l *Log) roll() error {
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+
+	if err := l.openSegment(l.segments[len(l.segments)-1].id + 1); err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(l.queues)) {
+		if err := l.write(record{op: opCreateQueue, queueName: name, data: l.queues[name]}); err != nil {
+			return err
+		}
+	}
+
+	for _, subscription := range l.subscriptions {
+		if err := l.write(record{op: opSubscribe, queueName: subscription.TopicName, data: []byte(subscription.QueueName)}); err != nil {
+			return err
+		}
+	}
+
+	return l.compact()
+}
+
+// compact removes head segments that no longer hold live messages.
+func (l *Log) compact() error {
+	for len(l.segments) > 1 && l.segments[0].live == 0 {
+		if err := os.Remove(l.segmentPath(l.segments[0].id)); err != nil {
+			return err
+		}
+
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+func (l *Log) openSegment(id uint64) error {
+	f, err := os.OpenFile(l.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if len(l.segments) == 0 || l.segments[len(l.segments)-1].id != id {
+		l.segments = append(l.segments, &segment{id: id, firstSeq: l.nextSeq})
+	}
+
+	l.active = f
+	l.activeSize = info.Size()
+
+	return nil
+}
+
+func (l *Log) segmentOf(seq uint64) *segment {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].firstSeq > seq
+	})
+
+	return l.segments[max(i-1, 0)]
+}
+
+func (l *Log) segmentPath(id uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (l *Log) recover() error {
+	ids, err := l.segmentIDs()
+	if err != nil {
+		return err
+	}
+
+	live := make(map[uint64]Entry)
+
+	for i, id := range ids {
+		seg := &segment{id: id, firstSeq: l.nextSeq}
+		l.segments = append(l.segments, seg)
+
+		if err := l.replaySegment(seg, live, i == len(ids)-1); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range live {
+		l.recovered = append(l.recovered, entry)
+	}
+
+	slices.SortFunc(l.recovered, func(a, b Entry) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+
+	if len(ids) == 0 {
+		return l.openSegment(1)
+	}
+
+	if err := l.openSegment(ids[len(ids)-1]); err != nil {
+		return err
+	}
+
+	return l.compact()
+}
+
+// replaySegment applies records of one segment. A torn tail of the last segment is a crash artifact and gets truncated.
+func (l *Log) replaySegment(seg *segment, live map[uint64]Entry, isLast bool) error {
+	path := l.segmentPath(seg.id)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+
+	var offset int64
+
+	for {
+		rec, n, err := readRecord(r, info.Size()-offset)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if errors.Is(err, ErrCorruptedLog) && isLast {
+			return os.Truncate(path, offset)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: segment %s at offset %d", err, filepath.Base(path), offset)
+		}
+
+		offset += n
+
+		l.apply(rec, seg, live)
+	}
+}
+
+func (l *Log) apply(rec record, seg *segment, live map[uint64]Entry) {
+	switch rec.op {
+	case opCreateQueue:
+		l.queues[rec.queueName] = rec.data
+	case opPutMessage:
+		live[rec.seq] = Entry{Seq: rec.seq, QueueName: rec.queueName, Data: rec.data}
+		seg.live++
+		// Only puts take seqs, a purge record carries the next seq without taking it
+		l.nextSeq = max(l.nextSeq, rec.seq+1)
+	case opDeleteMessage:
+		if _, ok := live[rec.seq]; ok {
+			delete(live, rec.seq)
+			l.segmentOf(rec.seq).live--
+		}
+	case opDeleteQueue:
+		delete(l.queues, rec.queueName)
+	case opPurgeQueue:
+		for seq, entry := range live {
+			if entry.QueueName == rec.queueName && seq < rec.seq {
+				delete(live, seq)
+				l.segmentOf(seq).live--
+			}
+		}
+	case opSubscribe:
+		l.addSubscription(Subscription{TopicName: rec.queueName, QueueName: string(rec.data)})
+	case opUnsubscribe:
+		l.deleteSubscription(Subscription{TopicName: rec.queueName, QueueName: string(rec.data)})
+	}
+}
+
+func (l *Log) addSubscription(subscription Subscription) {
+	if !slices.Contains(l.subscriptions, subscription) {
+		l.subscriptions = append(l.subscriptions, subscription)
+	}
+}
+
+func (l *Log) deleteSubscription(subscription Subscription) {
+	l.subscriptions = slices.DeleteFunc(l.subscriptions, func(s Subscription) bool {
+		return s == subscription
+	})
+}
+
+func (l *Log) segmentIDs() ([]uint64, error) {
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+
+	for _, dirEntry := range dirEntries {
+		name, ok := strings.CutSuffix(dirEntry.Name(), segmentExt)
+		if !ok || dirEntry.IsDir() {
+			continue
+		}
+
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (l *Log) syncLoop() {
+	defer close(l.syncDone)
+
+	ticker := time.NewTicker(l.options.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopSync:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			l.active.Sync()
+			l.mu.Unlock()
+		}
+	}
+}
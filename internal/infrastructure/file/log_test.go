@@ -0,0 +1,174 @@
+package file_test
+
+import (
+	"go-test-task/internal/infrastructure/file"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openLog(t *testing.T, dir string, segmentSize int64) *file.Log {
+	t.Helper()
+
+	log, err := file.OpenLog(dir, file.Options{SegmentSize: segmentSize, Sync: file.SyncAlways})
+	require.NoError(t, err)
+
+	return log
+}
+
+func putMessages(t *testing.T, log *file.Log, queueName string, contents ...string) []uint64 {
+	t.Helper()
+
+	seqs := make([]uint64, 0, len(contents))
+
+	for _, content := range contents {
+		seq, err := log.PutMessage(queueName, []byte(content))
+		require.NoError(t, err)
+
+		seqs = append(seqs, seq)
+	}
+
+	return seqs
+}
+
+func contentsOf(entries []file.Entry) []string {
+	contents := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		contents = append(contents, string(entry.Data))
+	}
+
+	return contents
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.NoError(t, err)
+
+	return paths
+}
+
+// damageTail changes the last segment the way a crash in the middle of a write would.
+func damageTail(t *testing.T, dir string, damage func(data []byte) []byte) {
+	t.Helper()
+
+	paths := segmentFiles(t, dir)
+	path := paths[len(paths)-1]
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, damage(data), 0o644))
+}
+
+func Test_Log_RecoversRecordsBeforeDamagedTail(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		damage func(data []byte) []byte
+	}{
+		{
+			name: "torn frame",
+			damage: func(data []byte) []byte {
+				return data[:len(data)-3]
+			},
+		},
+		{
+			name: "bad checksum",
+			damage: func(data []byte) []byte {
+				data[len(data)-1] ^= 0xff
+
+				return data
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			log := openLog(t, dir, 0)
+			require.NoError(t, log.CreateQueue("jobs", []byte("config")))
+			putMessages(t, log, "jobs", "first", "second", "third")
+			require.NoError(t, log.Close())
+
+			damageTail(t, dir, tt.damage)
+
+			log = openLog(t, dir, 0)
+			assert.Equal(t, map[string][]byte{"jobs": []byte("config")}, log.Queues())
+			assert.Equal(t, []string{"first", "second"}, contentsOf(log.Messages()))
+
+			// The damaged frame is cut off, so records appended after it are read back
+			seqs := putMessages(t, log, "jobs", "fourth")
+			assert.Equal(t, []uint64{3}, seqs)
+			require.NoError(t, log.Close())
+
+			log = openLog(t, dir, 0)
+			assert.Equal(t, []string{"first", "second", "fourth"}, contentsOf(log.Messages()))
+			require.NoError(t, log.Close())
+		})
+	}
+}
+
+func Test_Log_RejectsDamageBeforeLastSegment(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	log := openLog(t, dir, 1)
+	require.NoError(t, log.CreateQueue("jobs", nil))
+	putMessages(t, log, "jobs", "first", "second")
+	require.NoError(t, log.Close())
+
+	paths := segmentFiles(t, dir)
+	require.Len(t, paths, 2)
+
+	data, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(paths[0], data, 0o644))
+
+	_, err = file.OpenLog(dir, file.Options{SegmentSize: 1, Sync: file.SyncAlways})
+	assert.ErrorIs(t, err, file.ErrCorruptedLog)
+}
+
+func Test_Log_CompactionKeepsDeletedMessagesDeleted(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	log := openLog(t, dir, 1)
+	require.NoError(t, log.CreateQueue("jobs", []byte("config")))
+	require.NoError(t, log.Subscribe("events", "jobs"))
+	seqs := putMessages(t, log, "jobs", "first", "second", "third", "fourth")
+
+	for _, seq := range seqs[:3] {
+		require.NoError(t, log.DeleteMessage("jobs", seq))
+	}
+
+	require.NoError(t, log.Close())
+
+	// Every record rolled a segment, the head segments up to the one with the live message are removed
+	head, err := os.ReadFile(segmentFiles(t, dir)[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(head), "fourth")
+	assert.NotContains(t, string(head), "third")
+
+	log = openLog(t, dir, 1)
+	assert.Equal(t, []string{"fourth"}, contentsOf(log.Messages()))
+	assert.Equal(t, map[string][]byte{"jobs": []byte("config")}, log.Queues())
+	assert.Equal(t, []file.Subscription{{TopicName: "events", QueueName: "jobs"}}, log.Subscriptions())
+
+	require.NoError(t, log.DeleteMessage("jobs", seqs[3]))
+	require.NoError(t, log.Close())
+
+	log = openLog(t, dir, 1)
+	assert.Empty(t, log.Messages())
+	assert.Len(t, segmentFiles(t, dir), 1)
+	assert.Equal(t, map[string][]byte{"jobs": []byte("config")}, log.Queues())
+	require.NoError(t, log.Close())
+}
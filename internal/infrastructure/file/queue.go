@@ -0,0 +1,293 @@
+package file
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/valueobject"
+	"hash/maphash"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const shardCount = 64
+
+// FileQueue writes every change to the log before applying it to the wrapped storage,
+// which keeps the working set in memory and gets refilled from the log on start.
+// Reservations are not logged: a message reserved before a restart becomes visible again
+// and its delivery counter starts over.
+type FileQueue struct {
+	log     *Log
+	storage model.QueueStorage
+	// shards spread queues over their own locks like the memory storage, the log orders writes on its own.
+	shards []fileQueueShard
+	seed   maphash.Seed
+}
+
+type fileQueueShard struct {
+	// seqsPerQueueName maps IDs of stored messages to their log sequence numbers.
+	seqsPerQueueName map[string]map[string]uint64
+	// expiring lets the sweep log deletes of expired messages, which the wrapped storage drops on its own.
+	expiring expiryHeap
+	mu       sync.Mutex
+}
+
+func NewFileQueue(log *Log, storage model.QueueStorage) (*FileQueue, error) {
+	r := &FileQueue{log: log, storage: storage, shards: make([]fileQueueShard, shardCount), seed: maphash.MakeSeed()}
+	for i := range r.shards {
+		r.shards[i].seqsPerQueueName = make(map[string]map[string]uint64)
+	}
+
+	for _, entry := range log.Messages() {
+		var message valueobject.Message
+		if err := json.Unmarshal(entry.Data, &message); err != nil {
+			return nil, fmt.Errorf("%w: message %d: %w", ErrCorruptedLog, entry.Seq, err)
+		}
+
+		if err := storage.PutMessageToEnd(entry.QueueName, message); err != nil {
+			return nil, err
+		}
+
+		r.track(r.shardOf(entry.QueueName), entry.QueueName, message, entry.Seq)
+	}
+
+	return r, nil
+}
+
+// PutMessageToEnd deletes the logged message if the wrapped storage rejects it.
+func (r *FileQueue) PutMessageToEnd(queueName string, message valueobject.Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	seq, err := r.log.PutMessage(queueName, data)
+	if err != nil {
+		return err
+	}
+
+	if err := r.storage.PutMessageToEnd(queueName, message); err != nil {
+		r.log.DeleteMessage(queueName, seq)
+
+		return err
+	}
+
+	r.track(shard, queueName, message, seq)
+
+	return nil
+}
+
+// PutMessagesToEnd deletes already logged messages of the batch if logging one of them fails
+// or the wrapped storage rejects the batch.
+func (r *FileQueue) PutMessagesToEnd(queueName string, messages []valueobject.Message) error {
+	data := make([][]byte, len(messages))
+	for i, message := range messages {
+		var err error
+		if data[i], err = json.Marshal(message); err != nil {
+			return err
+		}
+	}
+
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	seqs := make([]uint64, 0, len(messages))
+	for _, messageData := range data {
+		seq, err := r.log.PutMessage(queueName, messageData)
+		if err != nil {
+			r.deleteLogged(queueName, seqs)
+
+			return err
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	if err := r.storage.PutMessagesToEnd(queueName, messages); err != nil {
+		r.deleteLogged(queueName, seqs)
+
+		return err
+	}
+
+	for i, message := range messages {
+		r.track(shard, queueName, message, seqs[i])
+	}
+
+	return nil
+}
+
+func (r *FileQueue) DeleteOldestMessages(queueName string, count, bytes int) ([]valueobject.Message, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	deleted, err := r.storage.DeleteOldestMessages(queueName, count, bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range deleted {
+		if err := r.untrack(shard, queueName, message.ID); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *FileQueue) ReserveFirstMessage(queueName, receipt string) (valueobject.Message, error) {
+	return r.storage.ReserveFirstMessage(queueName, receipt)
+}
+
+func (r *FileQueue) GetReservedMessage(queueName, receipt string) (valueobject.Message, error) {
+	return r.storage.GetReservedMessage(queueName, receipt)
+}
+
+func (r *FileQueue) DeleteReservedMessage(queueName, receipt string) (valueobject.Message, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	message, err := r.storage.DeleteReservedMessage(queueName, receipt)
+	if err != nil {
+		return valueobject.Message{}, err
+	}
+
+	return message, r.untrack(shard, queueName, message.ID)
+}
+
+func (r *FileQueue) ReleaseReservedMessage(queueName, receipt string) error {
+	return r.storage.ReleaseReservedMessage(queueName, receipt)
+}
+
+func (r *FileQueue) CountMessages(queueName string) (int, error) {
+	return r.storage.CountMessages(queueName)
+}
+
+func (r *FileQueue) CountBytes(queueName string) (int, error) {
+	return r.storage.CountBytes(queueName)
+}
+
+func (r *FileQueue) CountTotalBytes() (int, error) {
+	return r.storage.CountTotalBytes()
+}
+
+func (r *FileQueue) DeleteExpiredMessages() (int, error) {
+	deleted, err := r.storage.DeleteExpiredMessages()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for i := range r.shards {
+		if err := r.untrackExpired(&r.shards[i], now); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *FileQueue) untrackExpired(shard *fileQueueShard, now time.Time) error {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	for len(shard.expiring) > 0 && !now.Before(shard.expiring[0].expiresAt) {
+		expired := heap.Pop(&shard.expiring).(expiringMessage)
+		if err := r.untrack(shard, expired.queueName, expired.messageID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseDueMessages is not logged, messages recovered after their delivery time are visible at once.
+func (r *FileQueue) ReleaseDueMessages() ([]string, time.Time, error) {
+	return r.storage.ReleaseDueMessages()
+}
+
+func (r *FileQueue) GetQueueStats(queueName string) (model.QueueStats, error) {
+	return r.storage.GetQueueStats(queueName)
+}
+
+func (r *FileQueue) PurgeMessages(queueName string) (int, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	seqs := slices.Collect(maps.Values(shard.seqsPerQueueName[queueName]))
+	if len(seqs) > 0 {
+		if err := r.log.PurgeQueue(queueName, seqs); err != nil {
+			return 0, err
+		}
+	}
+
+	delete(shard.seqsPerQueueName, queueName)
+
+	return r.storage.PurgeMessages(queueName)
+}
+
+func (r *FileQueue) shardOf(queueName string) *fileQueueShard {
+	return &r.shards[maphash.String(r.seed, queueName)%uint64(len(r.shards))]
+}
+
+func (r *FileQueue) track(shard *fileQueueShard, queueName string, message valueobject.Message, seq uint64) {
+	if _, ok := shard.seqsPerQueueName[queueName]; !ok {
+		shard.seqsPerQueueName[queueName] = make(map[string]uint64)
+	}
+
+	shard.seqsPerQueueName[queueName][message.ID] = seq
+
+	if !message.ExpiresAt.IsZero() {
+		heap.Push(&shard.expiring, expiringMessage{expiresAt: message.ExpiresAt, queueName: queueName, messageID: message.ID})
+	}
+}
+
+// untrack logs the delete of a message unless it is already deleted.
+func (r *FileQueue) untrack(shard *fileQueueShard, queueName, messageID string) error {
+	seq, ok := shard.seqsPerQueueName[queueName][messageID]
+	if !ok {
+		return nil
+	}
+
+	delete(shard.seqsPerQueueName[queueName], messageID)
+
+	return r.log.DeleteMessage(queueName, seq)
+}
+
+// deleteLogged deletes messages that were logged but not stored.
+func (r *FileQueue) deleteLogged(queueName string, seqs []uint64) {
+	for _, seq := range seqs {
+		r.log.DeleteMessage(queueName, seq)
+	}
+}
+
+type expiringMessage struct {
+	expiresAt time.Time
+	queueName string
+	messageID string
+}
+
+type expiryHeap []expiringMessage
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiringMessage)) }
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return item
+}
@@ -0,0 +1,113 @@
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var ErrCorruptedLog = errors.New("corrupted log")
+
+// Every record is framed as: payload length (uint32) | crc32 of payload (uint32) | payload.
+// Payload is: op (1 byte) | seq (uvarint) | queue name length (uvarint) | queue name | data.
+const recordHeaderSize = 8
+
+type op byte
+
+const (
+	opCreateQueue op = iota + 1
+	opPutMessage
+	opDeleteMessage
+	// Subscription records keep the topic name in the queue name field and the queue name in data.
+	opSubscribe
+	opUnsubscribe
+	opDeleteQueue
+	// opPurgeQueue deletes all messages of the queue put before its seq.
+	opPurgeQueue
+)
+
+type record struct {
+	op        op
+	seq       uint64
+	queueName string
+	data      []byte
+}
+
+func (rec record) encode() []byte {
+	payload := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(rec.queueName)+len(rec.data))
+	payload = append(payload, byte(rec.op))
+	payload = binary.AppendUvarint(payload, rec.seq)
+	payload = binary.AppendUvarint(payload, uint64(len(rec.queueName)))
+	payload = append(payload, rec.queueName...)
+	payload = append(payload, rec.data...)
+
+	frame := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+
+	return append(frame, payload...)
+}
+
+// readRecord returns io.EOF on a clean end of segment and ErrCorruptedLog on a torn or damaged record.
+// remaining is the number of unread bytes in the segment, it bounds the payload length taken from a damaged header.
+func readRecord(r *bufio.Reader, remaining int64) (record, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) && n == 0 {
+			return record{}, 0, io.EOF
+		}
+
+		return record{}, 0, ErrCorruptedLog
+	}
+
+	payloadLen := int64(binary.LittleEndian.Uint32(header[0:4]))
+	if payloadLen > remaining-recordHeaderSize {
+		return record{}, 0, ErrCorruptedLog
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record{}, 0, ErrCorruptedLog
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return record{}, 0, ErrCorruptedLog
+	}
+
+	rec, err := decodePayload(payload)
+	if err != nil {
+		return record{}, 0, err
+	}
+
+	return rec, int64(recordHeaderSize + len(payload)), nil
+}
+
+func decodePayload(payload []byte) (record, error) {
+	if len(payload) == 0 {
+		return record{}, ErrCorruptedLog
+	}
+
+	rec := record{op: op(payload[0])}
+	rest := payload[1:]
+
+	seq, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return record{}, ErrCorruptedLog
+	}
+
+	rec.seq = seq
+	rest = rest[n:]
+
+	nameLen, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < nameLen {
+		return record{}, ErrCorruptedLog
+	}
+
+	rest = rest[n:]
+	rec.queueName = string(rest[:nameLen])
+	rec.data = rest[nameLen:]
+
+	return rec, nil
+}
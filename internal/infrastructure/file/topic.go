@@ -0,0 +1,60 @@
+package file
+
+import (
+	"errors"
+	"go-test-task/internal/domain/model"
+	"slices"
+	"sync"
+)
+
+// FileTopic records subscriptions in the log and restores them in the wrapped storage on start.
+type FileTopic struct {
+	log     *Log
+	storage model.TopicStorage
+	mu      sync.Mutex
+}
+
+func NewFileTopic(log *Log, storage model.TopicStorage) (*FileTopic, error) {
+	for _, subscription := range log.Subscriptions() {
+		if err := storage.Subscribe(subscription.TopicName, subscription.QueueName); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileTopic{log: log, storage: storage}, nil
+}
+
+func (r *FileTopic) Subscribe(topicName, queueName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribers, err := r.storage.GetSubscribers(topicName)
+	if err != nil && !errors.Is(err, model.ErrTopicNotFound) {
+		return err
+	}
+
+	if slices.Contains(subscribers, queueName) {
+		return nil
+	}
+
+	if err := r.log.Subscribe(topicName, queueName); err != nil {
+		return err
+	}
+
+	return r.storage.Subscribe(topicName, queueName)
+}
+
+func (r *FileTopic) Unsubscribe(topicName, queueName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.storage.Unsubscribe(topicName, queueName); err != nil {
+		return err
+	}
+
+	return r.log.Unsubscribe(topicName, queueName)
+}
+
+func (r *FileTopic) GetSubscribers(topicName string) ([]string, error) {
+	return r.storage.GetSubscribers(topicName)
+}
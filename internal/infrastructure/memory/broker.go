@@ -2,41 +2,71 @@ package memory
 
 import (
 	"go-test-task/internal/domain/model"
+	"hash/maphash"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
-type InMemoryBroker struct {
+type brokerShard struct {
 	queuesPerName map[string]*model.Queue
-	queueFactory  func(name string) *model.Queue
-	mu            sync.Mutex
+	mu            sync.RWMutex
+}
+
+type InMemoryBroker struct {
+	shards      []brokerShard
+	seed        maphash.Seed
+	countQueues atomic.Int64
+	queueRepo   model.QueueStorage
 }
 
-func NewInMemoryBroker(startLen int, queueFactory func(name string) *model.Queue) *InMemoryBroker {
-	return &InMemoryBroker{
-		queuesPerName: make(map[string]*model.Queue, startLen),
-		queueFactory:  queueFactory,
+func NewInMemoryBroker(startLen int, queueRepo model.QueueStorage) *InMemoryBroker {
+	r := &InMemoryBroker{
+		shards:    make([]brokerShard, shardCount),
+		seed:      maphash.MakeSeed(),
+		queueRepo: queueRepo,
 	}
+	for i := range r.shards {
+		r.shards[i].queuesPerName = make(map[string]*model.Queue, startLen/shardCount)
+	}
+
+	return r
 }
 
-func (r *InMemoryBroker) CreateQueue(queueName string) (*model.Queue, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *InMemoryBroker) CreateQueue(queueName string, config model.QueueConfig) (*model.Queue, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	if _, exists := r.queuesPerName[queueName]; exists {
-		return r.queuesPerName[queueName], nil
+	if _, exists := shard.queuesPerName[queueName]; exists {
+		return shard.queuesPerName[queueName], nil
 	}
 
-	queue := r.queueFactory(queueName)
-	r.queuesPerName[queueName] = queue
+	queue := model.NewQueue(queueName, config, r.queueRepo)
+	shard.queuesPerName[queueName] = queue
+	r.countQueues.Add(1)
 
 	return queue, nil
 }
 
+func (r *InMemoryBroker) UpdateQueueConfig(queueName string, config model.QueueConfig) error {
+	queue, err := r.GetQueue(queueName)
+	if err != nil {
+		return err
+	}
+
+	queue.SetConfig(config)
+
+	return nil
+}
+
 func (r *InMemoryBroker) GetQueue(queueName string) (*model.Queue, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	shard := r.shardOf(queueName)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
 
-	queue, isExist := r.queuesPerName[queueName]
+	queue, isExist := shard.queuesPerName[queueName]
 	if !isExist {
 		return nil, model.ErrQueueNotFound
 	}
@@ -45,8 +75,43 @@ func (r *InMemoryBroker) GetQueue(queueName string) (*model.Queue, error) {
 }
 
 func (r *InMemoryBroker) CountQueues() (int, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	return int(r.countQueues.Load()), nil
+}
+
+func (r *InMemoryBroker) CountBytes() (int, error) {
+	return r.queueRepo.CountTotalBytes()
+}
+
+func (r *InMemoryBroker) ListQueues() ([]string, error) {
+	var queueNames []string
+
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mu.RLock()
+		queueNames = slices.AppendSeq(queueNames, maps.Keys(shard.queuesPerName))
+		shard.mu.RUnlock()
+	}
+
+	slices.Sort(queueNames)
+
+	return queueNames, nil
+}
+
+func (r *InMemoryBroker) DeleteQueue(queueName string) error {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, exists := shard.queuesPerName[queueName]; !exists {
+		return model.ErrQueueNotFound
+	}
+
+	delete(shard.queuesPerName, queueName)
+	r.countQueues.Add(-1)
+
+	return nil
+}
 
-	return len(r.queuesPerName), nil
+func (r *InMemoryBroker) shardOf(queueName string) *brokerShard {
+	return &r.shards[shardIndex(r.seed, queueName, len(r.shards))]
 }
@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"slices"
+	"sort"
+)
+
+const dequeChunkSize = 64
+
+type dequeChunk [dequeChunkSize]queuedMessage
+
+// messageDeque is a double-ended queue kept in fixed-size chunks. Vacated slots are cleared
+// and emptied chunks are dropped, so memory stays proportional to the number of held messages.
+type messageDeque struct {
+	chunks []*dequeChunk
+	// head is the index of the first message in chunks[0].
+	head   int
+	length int
+	// spare keeps one dropped chunk, so a queue hovering around a chunk boundary does not allocate on every push.
+	spare *dequeChunk
+}
+
+func (d *messageDeque) Len() int {
+	return d.length
+}
+
+func (d *messageDeque) at(i int) *queuedMessage {
+	i += d.head
+
+	return &d.chunks[i/dequeChunkSize][i%dequeChunkSize]
+}
+
+func (d *messageDeque) Front() (queuedMessage, bool) {
+	if d.length == 0 {
+		return queuedMessage{}, false
+	}
+
+	return *d.at(0), true
+}
+
+func (d *messageDeque) PushBack(queued queuedMessage) {
+	if d.head+d.length == len(d.chunks)*dequeChunkSize {
+		d.chunks = append(d.chunks, d.newChunk())
+	}
+
+	d.length++
+	*d.at(d.length - 1) = queued
+}
+
+func (d *messageDeque) PushFront(queued queuedMessage) {
+	if d.head == 0 {
+		d.chunks = slices.Insert(d.chunks, 0, d.newChunk())
+		d.head = dequeChunkSize
+	}
+
+	d.head--
+	d.length++
+	*d.at(0) = queued
+}
+
+func (d *messageDeque) PopFront() (queuedMessage, bool) {
+	if d.length == 0 {
+		return queuedMessage{}, false
+	}
+
+	slot := d.at(0)
+	queued := *slot
+	*slot = queuedMessage{}
+
+	d.head++
+	d.length--
+
+	if d.head == dequeChunkSize {
+		d.dropFirstChunk()
+	}
+
+	if d.length == 0 {
+		d.head = 0
+	}
+
+	return queued, true
+}
+
+// InsertBySeq puts the message before the first one with a greater seq, shifting the shorter side of the deque.
+func (d *messageDeque) InsertBySeq(queued queuedMessage) {
+	i := sort.Search(d.length, func(j int) bool {
+		return d.at(j).seq >= queued.seq
+	})
+
+	if i < d.length/2 {
+		d.PushFront(queued)
+
+		for j := 0; j < i; j++ {
+			*d.at(j) = *d.at(j + 1)
+		}
+	} else {
+		d.PushBack(queued)
+
+		for j := d.length - 1; j > i; j-- {
+			*d.at(j) = *d.at(j - 1)
+		}
+	}
+
+	*d.at(i) = queued
+}
+
+// DeleteFunc deletes messages for which del returns true, keeping the order of the rest, and returns their number.
+func (d *messageDeque) DeleteFunc(del func(queuedMessage) bool) int {
+	kept := 0
+
+	for i := 0; i < d.length; i++ {
+		queued := *d.at(i)
+		if del(queued) {
+			continue
+		}
+
+		*d.at(kept) = queued
+		kept++
+	}
+
+	deleted := d.length - kept
+	d.truncate(kept)
+
+	return deleted
+}
+
+func (d *messageDeque) truncate(length int) {
+	for i := length; i < d.length; i++ {
+		*d.at(i) = queuedMessage{}
+	}
+
+	d.length = length
+
+	if d.length == 0 {
+		d.head = 0
+	}
+
+	needed := min((d.head+d.length+dequeChunkSize-1)/dequeChunkSize, len(d.chunks))
+	if d.length == 0 {
+		needed = min(1, len(d.chunks))
+	}
+
+	if len(d.chunks) > needed {
+		d.spare = d.chunks[needed]
+	}
+
+	clear(d.chunks[needed:])
+	d.chunks = d.chunks[:needed]
+}
+
+// dropFirstChunk reslices past the chunk instead of shifting the others, append moves them
+// to a new array once the old one runs out, so a drop stays O(1) amortized.
+func (d *messageDeque) dropFirstChunk() {
+	d.spare = d.chunks[0]
+	d.chunks[0] = nil
+	d.chunks = d.chunks[1:]
+	d.head = 0
+}
+
+func (d *messageDeque) newChunk() *dequeChunk {
+	if chunk := d.spare; chunk != nil {
+		d.spare = nil
+
+		return chunk
+	}
+
+	return new(dequeChunk)
+}
@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func Test_MessageDeque_MatchesSlice(t *testing.T) {
+	var (
+		deque     messageDeque
+		reference []queuedMessage
+		seq       uint64
+	)
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	for range 20000 {
+		switch op := rnd.IntN(10); {
+		case op < 4:
+			seq++
+			deque.PushBack(queuedMessage{seq: seq})
+			reference = append(reference, queuedMessage{seq: seq})
+		case op < 7:
+			queued, ok := deque.PopFront()
+			require.Equal(t, len(reference) > 0, ok)
+
+			if ok {
+				require.Equal(t, reference[0], queued)
+				reference = reference[1:]
+			}
+		case op < 9:
+			// Re-insert a message taken earlier, like a released reservation
+			queued := queuedMessage{seq: rnd.Uint64N(seq + 1)}
+			deque.InsertBySeq(queued)
+
+			i, _ := slices.BinarySearchFunc(reference, queued.seq, func(m queuedMessage, seq uint64) int {
+				return cmp.Compare(m.seq, seq)
+			})
+			reference = slices.Insert(reference, i, queued)
+		default:
+			limit := rnd.Uint64N(seq + 1)
+			deleted := deque.DeleteFunc(func(queued queuedMessage) bool { return queued.seq < limit })
+
+			before := len(reference)
+			reference = slices.DeleteFunc(reference, func(queued queuedMessage) bool { return queued.seq < limit })
+			require.Equal(t, before-len(reference), deleted)
+		}
+
+		require.Equal(t, len(reference), deque.Len())
+	}
+
+	for _, expected := range reference {
+		queued, ok := deque.PopFront()
+		require.True(t, ok)
+		assert.Equal(t, expected, queued)
+	}
+}
+
+func Test_MessageDeque_DropsConsumedChunks(t *testing.T) {
+	var deque messageDeque
+
+	for i := range 10 * dequeChunkSize {
+		deque.PushBack(queuedMessage{seq: uint64(i)})
+	}
+
+	for range 10*dequeChunkSize - 1 {
+		deque.PopFront()
+	}
+
+	assert.Len(t, deque.chunks, 1)
+	assert.Equal(t, 1, deque.Len())
+
+	for _, chunk := range deque.chunks {
+		for i, slot := range chunk {
+			if i != deque.head {
+				assert.Zero(t, slot, "vacated slot %d keeps its message", i)
+			}
+		}
+	}
+
+	deque.DeleteFunc(func(queuedMessage) bool { return true })
+	assert.LessOrEqual(t, len(deque.chunks), 1)
+	assert.Zero(t, deque.Len())
+}
+
+func Test_MessageDeque_DropsChunkWithoutShifting(t *testing.T) {
+	var deque messageDeque
+
+	for i := range 10 * dequeChunkSize {
+		deque.PushBack(queuedMessage{seq: uint64(i)})
+	}
+
+	second := &deque.chunks[1]
+
+	for range dequeChunkSize {
+		deque.PopFront()
+	}
+
+	assert.Same(t, second, &deque.chunks[0], "chunk pointers are not moved")
+	assert.Equal(t, uint64(dequeChunkSize), deque.at(0).seq)
+}
@@ -1,60 +1,562 @@
 package memory
 
 import (
+	"cmp"
+	"container/heap"
 	"go-test-task/internal/domain/model"
 	"go-test-task/internal/domain/valueobject"
+	"hash/maphash"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// queuedMessage keeps the put order, so a released message returns to its place.
+type queuedMessage struct {
+	seq     uint64
+	message valueobject.Message
+}
+
+// priorityLevel holds visible messages of one priority ordered by seq.
+type priorityLevel struct {
+	priority int
+	messages messageDeque
+}
+
+type messageList struct {
+	// levels are ordered from the highest priority, messages of a FIFO queue all have the same priority.
+	levels    []priorityLevel
+	reserved  map[string]queuedMessage
+	scheduled scheduledHeap
+	// nextExpiry is the earliest expiration among visible and scheduled messages, zero if none of them expires.
+	nextExpiry time.Time
+	// bytes is the size of all messages of the list, totalBytes of all lists of the storage.
+	bytes      int
+	totalBytes *atomic.Int64
+}
+
+type queueShard struct {
+	listsPerQueueName map[string]*messageList
+	mu                sync.Mutex
+}
+
+// InMemoryQueue spreads queues over shards with their own locks, so traffic on one queue does not block the others.
 type InMemoryQueue struct {
-	messagesPerQueueName map[string][]valueobject.Message
-	defaultQueueCapacity int
-	mu                   sync.Mutex
+	shards     []queueShard
+	seed       maphash.Seed
+	nextSeq    atomic.Uint64
+	totalBytes atomic.Int64
+}
+
+func NewInMemoryQueue(startLen int) *InMemoryQueue {
+	return newInMemoryQueue(startLen, shardCount)
 }
 
-func NewInMemoryQueue(startLen, defaultQueueCapacity int) *InMemoryQueue {
-	return &InMemoryQueue{
-		messagesPerQueueName: make(map[string][]valueobject.Message, startLen),
-		defaultQueueCapacity: defaultQueueCapacity,
+func newInMemoryQueue(startLen, shards int) *InMemoryQueue {
+	r := &InMemoryQueue{shards: make([]queueShard, shards), seed: maphash.MakeSeed()}
+	for i := range r.shards {
+		r.shards[i].listsPerQueueName = make(map[string]*messageList, startLen/shards)
 	}
+
+	return r
 }
 
 func (r *InMemoryQueue) PutMessageToEnd(queueName string, message valueobject.Message) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	if _, ok := r.messagesPerQueueName[queueName]; !ok {
-		r.messagesPerQueueName[queueName] = make([]valueobject.Message, 0, r.defaultQueueCapacity)
-	}
+	r.putMessage(r.getList(shard, queueName), message, time.Now())
 
-	r.messagesPerQueueName[queueName] = append(r.messagesPerQueueName[queueName], message)
+	return nil
+}
+
+func (r *InMemoryQueue) PutMessagesToEnd(queueName string, messages []valueobject.Message) error {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list := r.getList(shard, queueName)
+
+	now := time.Now()
+	for _, message := range messages {
+		r.putMessage(list, message, now)
+	}
 
 	return nil
 }
 
-func (r *InMemoryQueue) GetFirstMessage(queueName string) (valueobject.Message, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *InMemoryQueue) DeleteOldestMessages(queueName string, count, bytes int) ([]valueobject.Message, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		return nil, model.ErrMessageNotFound
+	}
+
+	now := time.Now()
+	r.releaseDueMessages(list, now)
+	list.deleteExpired(now)
+
+	var popped []queuedMessage
+
+	deletedBytes := 0
+
+	for len(popped) < count || deletedBytes < bytes {
+		queued, isExist := list.popOldest()
+		if !isExist {
+			// Not enough visible messages, the popped ones go back to their places
+			for _, queued := range popped {
+				list.insert(queued)
+			}
 
-	messageList, isExist := r.messagesPerQueueName[queueName]
-	if !isExist || len(messageList) == 0 {
+			return nil, model.ErrMessageNotFound
+		}
+
+		popped = append(popped, queued)
+		deletedBytes += queued.message.Size()
+	}
+
+	deleted := make([]valueobject.Message, len(popped))
+	for i, queued := range popped {
+		deleted[i] = queued.message
+	}
+
+	list.addBytes(-deletedBytes)
+
+	return deleted, nil
+}
+
+func (r *InMemoryQueue) ReserveFirstMessage(queueName, receipt string) (valueobject.Message, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		return valueobject.Message{}, model.ErrMessageNotFound
+	}
+
+	now := time.Now()
+	r.releaseDueMessages(list, now)
+	list.deleteExpired(now)
+
+	queued, isExist := list.popFirst()
+	if !isExist {
 		return valueobject.Message{}, model.ErrMessageNotFound
 	}
 
-	message := messageList[0]
-	r.messagesPerQueueName[queueName] = messageList[1:]
+	queued.message.Deliveries++
+	list.reserved[receipt] = queued
+
+	return queued.message, nil
+}
+
+func (r *InMemoryQueue) GetReservedMessage(queueName, receipt string) (valueobject.Message, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		return valueobject.Message{}, model.ErrReceiptNotFound
+	}
+
+	queued, isExist := list.reserved[receipt]
+	if !isExist {
+		return valueobject.Message{}, model.ErrReceiptNotFound
+	}
+
+	return queued.message, nil
+}
+
+func (r *InMemoryQueue) DeleteReservedMessage(queueName, receipt string) (valueobject.Message, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	return message, nil
+	queued, err := shard.popReservedMessage(queueName, receipt)
+	if err != nil {
+		return valueobject.Message{}, err
+	}
+
+	shard.listsPerQueueName[queueName].addBytes(-queued.message.Size())
+
+	return queued.message, nil
+}
+
+func (r *InMemoryQueue) ReleaseReservedMessage(queueName, receipt string) error {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	queued, err := shard.popReservedMessage(queueName, receipt)
+	if err != nil {
+		return err
+	}
+
+	list := r.getList(shard, queueName)
+	list.insert(queued)
+	list.trackExpiry(queued.message)
+
+	return nil
 }
 
+// CountMessages counts visible messages that have not expired and reserved messages.
 func (r *InMemoryQueue) CountMessages(queueName string) (int, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		return 0, nil
+	}
+
+	list.deleteExpired(time.Now())
+
+	return list.countVisible() + len(list.reserved) + len(list.scheduled), nil
+}
+
+// CountBytes returns the size of the messages counted by CountMessages.
+func (r *InMemoryQueue) CountBytes(queueName string) (int, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		return 0, nil
+	}
+
+	list.deleteExpired(time.Now())
+
+	return list.bytes, nil
+}
+
+// CountTotalBytes includes expired messages that are not deleted yet.
+func (r *InMemoryQueue) CountTotalBytes() (int, error) {
+	return int(r.totalBytes.Load()), nil
+}
+
+func (r *InMemoryQueue) DeleteExpiredMessages() (int, error) {
+	deleted := 0
+
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mu.Lock()
+
+		now := time.Now()
+		for _, list := range shard.listsPerQueueName {
+			deleted += list.deleteExpired(now)
+		}
+
+		shard.mu.Unlock()
+	}
+
+	return deleted, nil
+}
+
+func (r *InMemoryQueue) ReleaseDueMessages() ([]string, time.Time, error) {
+	var (
+		queueNames []string
+		next       time.Time
+	)
+
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mu.Lock()
+
+		now := time.Now()
+		for queueName, list := range shard.listsPerQueueName {
+			if r.releaseDueMessages(list, now) > 0 {
+				queueNames = append(queueNames, queueName)
+			}
+
+			if len(list.scheduled) > 0 && (next.IsZero() || list.scheduled[0].message.DeliverAt.Before(next)) {
+				next = list.scheduled[0].message.DeliverAt
+			}
+		}
+
+		shard.mu.Unlock()
+	}
+
+	return queueNames, next, nil
+}
+
+func (r *InMemoryQueue) GetQueueStats(queueName string) (model.QueueStats, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		return model.QueueStats{}, nil
+	}
 
-	messageList, isExist := r.messagesPerQueueName[queueName]
+	now := time.Now()
+	r.releaseDueMessages(list, now)
+	list.deleteExpired(now)
+
+	stats := model.QueueStats{
+		Visible:   list.countVisible(),
+		Reserved:  len(list.reserved),
+		Scheduled: len(list.scheduled),
+		Bytes:     list.bytes,
+	}
+
+	// Only heads are checked: a delayed message may be enqueued before the head, but it became visible after it
+	for _, level := range list.levels {
+		if head, isExist := level.messages.Front(); isExist {
+			enqueuedAt := head.message.EnqueuedAt
+			if stats.OldestEnqueuedAt.IsZero() || enqueuedAt.Before(stats.OldestEnqueuedAt) {
+				stats.OldestEnqueuedAt = enqueuedAt
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func (r *InMemoryQueue) PurgeMessages(queueName string) (int, error) {
+	shard := r.shardOf(queueName)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	list, isExist := shard.listsPerQueueName[queueName]
 	if !isExist {
 		return 0, nil
 	}
 
-	return len(messageList), nil
+	delete(shard.listsPerQueueName, queueName)
+	list.addBytes(-list.bytes)
+
+	return list.countVisible() + len(list.reserved) + len(list.scheduled), nil
+}
+
+func (r *InMemoryQueue) putMessage(list *messageList, message valueobject.Message, now time.Time) {
+	list.trackExpiry(message)
+	list.addBytes(message.Size())
+
+	if !message.IsDue(now) {
+		heap.Push(&list.scheduled, queuedMessage{seq: r.nextSeq.Add(1), message: message})
+
+		return
+	}
+
+	r.appendMessage(list, message)
+}
+
+func (r *InMemoryQueue) releaseDueMessages(list *messageList, now time.Time) int {
+	released := 0
+
+	for len(list.scheduled) > 0 && list.scheduled[0].message.IsDue(now) {
+		r.appendMessage(list, heap.Pop(&list.scheduled).(queuedMessage).message)
+		released++
+	}
+
+	return released
+}
+
+// appendMessage gives the message the next seq, so the queue stays ordered by seq.
+// Seqs are shared by all shards, but a list only gets them under its shard lock, so they grow within the list.
+func (r *InMemoryQueue) appendMessage(list *messageList, message valueobject.Message) {
+	level := list.level(message.Priority)
+	level.messages.PushBack(queuedMessage{seq: r.nextSeq.Add(1), message: message})
+}
+
+func (r *InMemoryQueue) shardOf(queueName string) *queueShard {
+	return &r.shards[shardIndex(r.seed, queueName, len(r.shards))]
+}
+
+func (r *InMemoryQueue) getList(shard *queueShard, queueName string) *messageList {
+	list, isExist := shard.listsPerQueueName[queueName]
+	if !isExist {
+		list = &messageList{
+			levels:     []priorityLevel{{}},
+			reserved:   make(map[string]queuedMessage),
+			totalBytes: &r.totalBytes,
+		}
+		shard.listsPerQueueName[queueName] = list
+	}
+
+	return list
+}
+
+func (s *queueShard) popReservedMessage(queueName, receipt string) (queuedMessage, error) {
+	list, isExist := s.listsPerQueueName[queueName]
+	if !isExist {
+		return queuedMessage{}, model.ErrReceiptNotFound
+	}
+
+	queued, isExist := list.reserved[receipt]
+	if !isExist {
+		return queuedMessage{}, model.ErrReceiptNotFound
+	}
+
+	delete(list.reserved, receipt)
+
+	return queued, nil
+}
+
+// level returns the level of the priority, adding it if the list has none.
+func (l *messageList) level(priority int) *priorityLevel {
+	i, isExist := slices.BinarySearchFunc(l.levels, priority, func(level priorityLevel, priority int) int {
+		return cmp.Compare(priority, level.priority)
+	})
+	if !isExist {
+		l.levels = slices.Insert(l.levels, i, priorityLevel{priority: priority})
+	}
+
+	return &l.levels[i]
+}
+
+func (l *messageList) popFirst() (queuedMessage, bool) {
+	for i := range l.levels {
+		level := &l.levels[i]
+		queued, isExist := level.messages.PopFront()
+		if !isExist {
+			continue
+		}
+
+		if level.messages.Len() == 0 {
+			l.dropEmptyLevels()
+		}
+
+		return queued, true
+	}
+
+	return queuedMessage{}, false
+}
+
+// popOldest removes the visible message with the lowest seq of all levels.
+func (l *messageList) popOldest() (queuedMessage, bool) {
+	oldest := -1
+
+	var oldestSeq uint64
+
+	for i := range l.levels {
+		front, isExist := l.levels[i].messages.Front()
+		if isExist && (oldest < 0 || front.seq < oldestSeq) {
+			oldest, oldestSeq = i, front.seq
+		}
+	}
+
+	if oldest < 0 {
+		return queuedMessage{}, false
+	}
+
+	level := &l.levels[oldest]
+	queued, _ := level.messages.PopFront()
+
+	if level.messages.Len() == 0 {
+		l.dropEmptyLevels()
+	}
+
+	return queued, true
+}
+
+// insert puts a released message back to its place in the level of its priority.
+func (l *messageList) insert(queued queuedMessage) {
+	l.level(queued.message.Priority).messages.InsertBySeq(queued)
+}
+
+func (l *messageList) countVisible() int {
+	count := 0
+	for _, level := range l.levels {
+		count += level.messages.Len()
+	}
+
+	return count
+}
+
+// dropEmptyLevels keeps the last level, so a FIFO queue does not reallocate it every time it runs empty.
+func (l *messageList) dropEmptyLevels() {
+	if len(l.levels) == 1 {
+		return
+	}
+
+	l.levels = slices.DeleteFunc(l.levels, func(level priorityLevel) bool {
+		return level.messages.Len() == 0
+	})
+	if len(l.levels) == 0 {
+		l.levels = append(l.levels, priorityLevel{})
+	}
+}
+
+func (l *messageList) addBytes(delta int) {
+	l.bytes += delta
+	l.totalBytes.Add(int64(delta))
+}
+
+func (l *messageList) trackExpiry(message valueobject.Message) {
+	if !message.ExpiresAt.IsZero() && (l.nextExpiry.IsZero() || message.ExpiresAt.Before(l.nextExpiry)) {
+		l.nextExpiry = message.ExpiresAt
+	}
+}
+
+// deleteExpired scans the list only once the earliest expiration has passed.
+func (l *messageList) deleteExpired(now time.Time) int {
+	if l.nextExpiry.IsZero() || now.Before(l.nextExpiry) {
+		return 0
+	}
+
+	count := l.countVisible() + len(l.scheduled)
+
+	l.nextExpiry = time.Time{}
+	for i := range l.levels {
+		l.levels[i].messages.DeleteFunc(func(queued queuedMessage) bool {
+			if queued.message.IsExpired(now) {
+				l.addBytes(-queued.message.Size())
+
+				return true
+			}
+
+			l.trackExpiry(queued.message)
+
+			return false
+		})
+	}
+	l.dropEmptyLevels()
+	l.scheduled = slices.DeleteFunc(l.scheduled, func(queued queuedMessage) bool {
+		if queued.message.IsExpired(now) {
+			l.addBytes(-queued.message.Size())
+
+			return true
+		}
+
+		l.trackExpiry(queued.message)
+
+		return false
+	})
+	heap.Init(&l.scheduled)
+
+	return count - l.countVisible() - len(l.scheduled)
+}
+
+// scheduledHeap orders not yet delivered messages by delivery time, then by put order.
+type scheduledHeap []queuedMessage
+
+func (h scheduledHeap) Len() int      { return len(h) }
+func (h scheduledHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *scheduledHeap) Push(x any)   { *h = append(*h, x.(queuedMessage)) }
+
+func (h scheduledHeap) Less(i, j int) bool {
+	if !h[i].message.DeliverAt.Equal(h[j].message.DeliverAt) {
+		return h[i].message.DeliverAt.Before(h[j].message.DeliverAt)
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h *scheduledHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = queuedMessage{}
+	*h = old[:len(old)-1]
+
+	return item
 }
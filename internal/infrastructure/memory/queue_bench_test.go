@@ -0,0 +1,226 @@
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"go-test-task/internal/domain/model"
+	"go-test-task/internal/domain/valueobject"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// sliceList is what the deque is measured against: the plain slice InMemoryQueue used before,
+// which popped with list[1:] and so kept consumed messages reachable until the next reallocation.
+type sliceList []queuedMessage
+
+func (l *sliceList) PushBack(queued queuedMessage) {
+	*l = append(*l, queued)
+}
+
+func (l *sliceList) PopFront() (queuedMessage, bool) {
+	if len(*l) == 0 {
+		return queuedMessage{}, false
+	}
+
+	queued := (*l)[0]
+	*l = (*l)[1:]
+
+	return queued, true
+}
+
+func (l *sliceList) InsertBySeq(queued queuedMessage) {
+	i, _ := slices.BinarySearchFunc(*l, queued.seq, func(m queuedMessage, seq uint64) int {
+		return cmp.Compare(m.seq, seq)
+	})
+	*l = slices.Insert(*l, i, queued)
+}
+
+type benchList interface {
+	PushBack(queued queuedMessage)
+	PopFront() (queuedMessage, bool)
+	InsertBySeq(queued queuedMessage)
+}
+
+var benchLists = []struct {
+	name    string
+	newList func() benchList
+}{
+	{name: "deque", newList: func() benchList { return &messageDeque{} }},
+	{name: "slice", newList: func() benchList { return &sliceList{} }},
+}
+
+func Benchmark_List_PushPopSteady(b *testing.B) {
+	for _, live := range []int{10, 10000} {
+		for _, bl := range benchLists {
+			b.Run(fmt.Sprintf("%s/live=%d", bl.name, live), func(b *testing.B) {
+				list := bl.newList()
+
+				var seq uint64
+				for ; seq < uint64(live); seq++ {
+					list.PushBack(queuedMessage{seq: seq})
+				}
+
+				b.ReportAllocs()
+
+				for b.Loop() {
+					seq++
+					list.PushBack(queuedMessage{seq: seq})
+					list.PopFront()
+				}
+			})
+		}
+	}
+}
+
+func Benchmark_List_FillDrain(b *testing.B) {
+	const size = 10000
+
+	for _, bl := range benchLists {
+		b.Run(bl.name, func(b *testing.B) {
+			list := bl.newList()
+
+			b.ReportAllocs()
+
+			for b.Loop() {
+				for i := range size {
+					list.PushBack(queuedMessage{seq: uint64(i)})
+				}
+
+				for range size {
+					list.PopFront()
+				}
+			}
+		})
+	}
+}
+
+// Benchmark_List_ReleaseNearHead re-inserts a popped message right away, as a nack of the first message does.
+func Benchmark_List_ReleaseNearHead(b *testing.B) {
+	const live = 10000
+
+	for _, bl := range benchLists {
+		b.Run(bl.name, func(b *testing.B) {
+			list := bl.newList()
+			for i := range live {
+				list.PushBack(queuedMessage{seq: uint64(i)})
+			}
+
+			b.ReportAllocs()
+
+			for b.Loop() {
+				queued, _ := list.PopFront()
+				list.InsertBySeq(queued)
+			}
+		})
+	}
+}
+
+// Benchmark_List_RetainedAfterBurst reports the heap still in use after a burst of messages was consumed
+// down to a few live ones.
+func Benchmark_List_RetainedAfterBurst(b *testing.B) {
+	const (
+		burst = 20000
+		live  = 10
+	)
+
+	content := strings.Repeat("x", 1024)
+
+	for _, bl := range benchLists {
+		b.Run(bl.name, func(b *testing.B) {
+			var retained uint64
+
+			for b.Loop() {
+				before := heapInUse()
+
+				list := bl.newList()
+				for i := range burst {
+					// Every message gets its own content, as decoded request bodies do
+					list.PushBack(queuedMessage{seq: uint64(i), message: valueobject.Message{Content: strings.Clone(content)}})
+				}
+
+				for range burst - live {
+					list.PopFront()
+				}
+
+				retained = max(heapInUse(), before) - before
+				runtime.KeepAlive(list)
+			}
+
+			b.ReportMetric(float64(retained), "retained-B")
+		})
+	}
+}
+
+func Benchmark_InMemoryQueue_PutReserveAck(b *testing.B) {
+	repository := NewInMemoryQueue(1)
+	message := valueobject.Message{Content: "benchmark"}
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if err := repository.PutMessageToEnd("bench", message); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := repository.ReserveFirstMessage("bench", "receipt"); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := repository.DeleteReservedMessage("bench", "receipt"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return stats.HeapAlloc
+}
+
+// Benchmark_InMemoryQueue_ParallelQueues gives every goroutine its own queue. Run with -cpu 1,2,4,8
+// to see throughput scale with GOMAXPROCS once queues stop sharing one lock.
+func Benchmark_InMemoryQueue_ParallelQueues(b *testing.B) {
+	for _, shards := range []int{1, shardCount} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			repository := newInMemoryQueue(0, shards)
+			message := valueobject.Message{Content: "benchmark"}
+
+			var nextQueue atomic.Int64
+
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				queueName := fmt.Sprint("bench-", nextQueue.Add(1))
+
+				for pb.Next() {
+					repository.PutMessageToEnd(queueName, message)
+					repository.ReserveFirstMessage(queueName, "receipt")
+					repository.DeleteReservedMessage(queueName, "receipt")
+				}
+			})
+		})
+	}
+}
+
+func Benchmark_InMemoryBroker_ParallelGetQueue(b *testing.B) {
+	repository := NewInMemoryBroker(0, nil)
+
+	var nextQueue atomic.Int64
+
+	b.RunParallel(func(pb *testing.PB) {
+		queueName := fmt.Sprint("bench-", nextQueue.Add(1))
+		repository.CreateQueue(queueName, model.QueueConfig{Type: model.QueueTypeFIFO})
+
+		for pb.Next() {
+			if _, err := repository.GetQueue(queueName); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
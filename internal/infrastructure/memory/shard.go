@@ -0,0 +1,10 @@
+package memory
+
+import "hash/maphash"
+
+const shardCount = 64
+
+// shardIndex spreads names over shards, so operations on different queues rarely share a lock.
+func shardIndex(seed maphash.Seed, name string, shards int) int {
+	return int(maphash.String(seed, name) % uint64(shards))
+}
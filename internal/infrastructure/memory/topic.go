@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"go-test-task/internal/domain/model"
+	"slices"
+	"sync"
+)
+
+type InMemoryTopic struct {
+	subscribersPerTopic map[string][]string
+	mu                  sync.Mutex
+}
+
+func NewInMemoryTopic() *InMemoryTopic {
+	return &InMemoryTopic{subscribersPerTopic: make(map[string][]string)}
+}
+
+func (r *InMemoryTopic) Subscribe(topicName, queueName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !slices.Contains(r.subscribersPerTopic[topicName], queueName) {
+		r.subscribersPerTopic[topicName] = append(r.subscribersPerTopic[topicName], queueName)
+	}
+
+	return nil
+}
+
+func (r *InMemoryTopic) Unsubscribe(topicName, queueName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribers := r.subscribersPerTopic[topicName]
+
+	i := slices.Index(subscribers, queueName)
+	if i < 0 {
+		return model.ErrTopicNotFound
+	}
+
+	subscribers = slices.Delete(subscribers, i, i+1)
+	if len(subscribers) == 0 {
+		delete(r.subscribersPerTopic, topicName)
+
+		return nil
+	}
+
+	r.subscribersPerTopic[topicName] = subscribers
+
+	return nil
+}
+
+func (r *InMemoryTopic) GetSubscribers(topicName string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribers, isExist := r.subscribersPerTopic[topicName]
+	if !isExist {
+		return nil, model.ErrTopicNotFound
+	}
+
+	return slices.Clone(subscribers), nil
+}
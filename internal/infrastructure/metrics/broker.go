@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"errors"
+	"go-test-task/internal/domain/model"
+	"time"
+)
+
+// BrokerMetrics keeps metrics of queues in the registry.
+type BrokerMetrics struct {
+	enqueued     *CounterVec
+	dequeued     *CounterVec
+	rejected     *CounterVec
+	waits        *HistogramVec
+	waitTimeouts *HistogramVec
+	depth        *GaugeVec
+	waiters      *GaugeVec
+}
+
+// rejectReasons label rejected puts by the error, other errors are labeled "other".
+var rejectReasons = []struct {
+	err    error
+	reason string
+}{
+	{model.ErrQueueIsFull, "queue_full"},
+	{model.ErrBrokerIsFull, "broker_full"},
+	{model.ErrQueueBytesExceeded, "queue_bytes_exceeded"},
+	{model.ErrBrokerBytesExceeded, "broker_bytes_exceeded"},
+	{model.ErrMessageTooLarge, "message_too_large"},
+	{model.ErrQueueNotFound, "queue_not_found"},
+	{model.ErrQueueDeleted, "queue_deleted"},
+	{model.ErrDraining, "draining"},
+}
+
+func NewBrokerMetrics(registry *Registry) *BrokerMetrics {
+	return &BrokerMetrics{
+		enqueued:     registry.NewCounterVec("queue_messages_enqueued_total", "Messages put to the queue.", "queue"),
+		dequeued:     registry.NewCounterVec("queue_messages_dequeued_total", "Messages taken from the queue by consumers.", "queue"),
+		rejected:     registry.NewCounterVec("queue_puts_rejected_total", "Puts to the queue that failed, by reason.", "queue", "reason"),
+		waits:        registry.NewHistogramVec("queue_wait_seconds", "Time consumers waited for a message they got.", DefaultBuckets, "queue"),
+		waitTimeouts: registry.NewHistogramVec("queue_wait_timeout_seconds", "Time consumers waited before their long poll timed out.", DefaultBuckets, "queue"),
+		depth:        registry.NewGaugeVec("queue_depth", "Messages held by the queue, by state.", "queue", "state"),
+		waiters:      registry.NewGaugeVec("queue_waiters", "Consumers waiting for messages of the queue.", "queue"),
+	}
+}
+
+func (m *BrokerMetrics) ObservePut(queueName string, count int) {
+	m.enqueued.Add(float64(count), queueName)
+}
+
+func (m *BrokerMetrics) ObservePutRejected(queueName string, err error) {
+	reason := "other"
+	for _, r := range rejectReasons {
+		if errors.Is(err, r.err) {
+			reason = r.reason
+
+			break
+		}
+	}
+
+	m.rejected.Inc(queueName, reason)
+}
+
+func (m *BrokerMetrics) ObserveTake(queueName string, count int, wait time.Duration) {
+	m.dequeued.Add(float64(count), queueName)
+	m.waits.Observe(wait.Seconds(), queueName)
+}
+
+func (m *BrokerMetrics) ObserveWaitTimeout(queueName string, wait time.Duration) {
+	m.waitTimeouts.Observe(wait.Seconds(), queueName)
+}
+
+func (m *BrokerMetrics) ForgetQueue(queueName string) {
+	m.enqueued.Delete("queue", queueName)
+	m.dequeued.Delete("queue", queueName)
+	m.rejected.Delete("queue", queueName)
+	m.waits.Delete("queue", queueName)
+	m.waitTimeouts.Delete("queue", queueName)
+	m.depth.Delete("queue", queueName)
+	m.waiters.Delete("queue", queueName)
+}
+
+// ResetQueueStats forgets gauges of all queues before they are set anew for a scrape.
+func (m *BrokerMetrics) ResetQueueStats() {
+	m.depth.Reset()
+	m.waiters.Reset()
+}
+
+func (m *BrokerMetrics) SetQueueStats(queueName string, stats model.QueueStats, waiters int) {
+	m.depth.Set(float64(stats.Visible), queueName, "visible")
+	m.depth.Set(float64(stats.Reserved), queueName, "reserved")
+	m.depth.Set(float64(stats.Scheduled), queueName, "scheduled")
+	m.waiters.Set(float64(waiters), queueName)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"go-test-task/internal/transport"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// HttpMiddleware observes how long actions take to handle requests, labeled by method and route.
+func HttpMiddleware(registry *Registry) transport.Middleware {
+	durations := registry.NewHistogramVec("http_request_duration_seconds", "Time actions took to handle requests.", DefaultBuckets, "action", "code")
+
+	return func(action transport.Action, next transport.Handler) transport.Handler {
+		label := action.Method() + " " + action.Route()
+
+		return func(w http.ResponseWriter, r *http.Request, params transport.Params) {
+			startedAt := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+			next(sw, r, params)
+
+			durations.Observe(time.Since(startedAt).Seconds(), label, strconv.Itoa(sw.status))
+		}
+	}
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the flusher and deadlines of the connection.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,301 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are upper bounds of histogram buckets in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Registry writes its metric families in the Prometheus text exposition format.
+type Registry struct {
+	families []family
+	mu       sync.Mutex
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// vec holds series of a metric family by their label values.
+type vec[S any] struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	series     map[string]*S
+	newSeries  func() *S
+	mu         sync.Mutex
+}
+
+type CounterVec struct {
+	vec[float64]
+}
+
+type GaugeVec struct {
+	vec[float64]
+}
+
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	// counts are not cumulative, the last one counts values above all buckets.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newVec[float64](name, help, "counter", labelNames, func() *float64 { return new(float64) })}
+	r.register(c)
+
+	return c
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{newVec[float64](name, help, "gauge", labelNames, func() *float64 { return new(float64) })}
+	r.register(g)
+
+	return g
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{buckets: buckets}
+	h.vec = newVec(name, help, "histogram", labelNames, func() *histogram {
+		return &histogram{counts: make([]uint64, len(buckets)+1)}
+	})
+	r.register(h)
+
+	return h
+}
+
+// WriteText writes all families in the order they were registered.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families = append(r.families, f)
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.get(labelValues) += value
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	*g.get(labelValues) = value
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues)
+	i, _ := slices.BinarySearch(h.buckets, value)
+	s.counts[i]++
+	s.sum += value
+	s.count++
+}
+
+// Delete forgets the series with a label equal to the value, e.g. of a deleted queue.
+func (v *vec[S]) Delete(labelName, labelValue string) {
+	i := slices.Index(v.labelNames, labelName)
+	if i < 0 {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for key := range v.series {
+		if strings.Split(key, labelSeparator)[i] == labelValue {
+			delete(v.series, key)
+		}
+	}
+}
+
+// Reset forgets all series.
+func (v *vec[S]) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	clear(v.series)
+}
+
+const labelSeparator = "\xff"
+
+func newVec[S any](name, help, metricType string, labelNames []string, newSeries func() *S) vec[S] {
+	return vec[S]{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		series:     make(map[string]*S),
+		newSeries:  newSeries,
+	}
+}
+
+// get must be called under v.mu.
+func (v *vec[S]) get(labelValues []string) *S {
+	key := strings.Join(labelValues, labelSeparator)
+
+	s, isExist := v.series[key]
+	if !isExist {
+		s = v.newSeries()
+		v.series[key] = s
+	}
+
+	return s
+}
+
+func (v *vec[S]) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + v.name + " " + strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v.help) + "\n")
+	w.WriteString("# TYPE " + v.name + " " + v.metricType + "\n")
+}
+
+// sortedKeys must be called under v.mu.
+func (v *vec[S]) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeScalars(w, &c.vec)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	writeScalars(w, &g.vec)
+}
+
+func writeScalars(w *bufio.Writer, v *vec[float64]) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+
+	for _, key := range v.sortedKeys() {
+		writeSample(w, v.name, labels(v.labelNames, key), *v.series[key])
+	}
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+
+	for _, key := range h.sortedKeys() {
+		s := h.series[key]
+		seriesLabels := labels(h.labelNames, key)
+
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+
+			writeSample(w, h.name+"_bucket", append(slices.Clone(seriesLabels), label{"le", formatFloat(le)}), float64(cumulative))
+		}
+
+		writeSample(w, h.name+"_sum", seriesLabels, s.sum)
+		writeSample(w, h.name+"_count", seriesLabels, float64(s.count))
+	}
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+func labels(names []string, key string) []label {
+	if len(names) == 0 {
+		return nil
+	}
+
+	values := strings.Split(key, labelSeparator)
+	result := make([]label, len(names))
+	for i, name := range names {
+		result[i] = label{name: name, value: values[i]}
+	}
+
+	return result
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeSample(w *bufio.Writer, name string, labels []label, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 {
+		w.WriteByte('{')
+
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+
+			w.WriteString(l.name + `="` + labelValueEscaper.Replace(l.value) + `"`)
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
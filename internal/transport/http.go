@@ -1,7 +1,9 @@
 package transport
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -11,60 +13,231 @@ type Action interface {
 	Handle(w http.ResponseWriter, r *http.Request, params Params)
 }
 
+// UnsafeAction is implemented by GET actions changing state, e.g. taking messages, so HEAD requests do not reach them.
+type UnsafeAction interface {
+	IsUnsafe() bool
+}
+
 type Params map[string]string
 
+// Handler handles a request routed to an action.
+type Handler func(w http.ResponseWriter, r *http.Request, params Params)
+
+// Middleware wraps the handler of the action, e.g. to time, authorize or log its requests.
+// It is called once per action when the chain is built, the returned Handler per request.
+type Middleware func(action Action, next Handler) Handler
+
+// ActionMiddlewares is implemented by actions with middlewares of their own.
+type ActionMiddlewares interface {
+	Middlewares() []Middleware
+}
+
+type route struct {
+	action   Action
+	segments []string
+	handler  Handler
+}
+
+// Http routes requests by method and path. A route segment in braces is a param matching one path segment,
+// the last one may end with "..." to match the rest of the path, e.g. "/files/{path...}".
+// When several routes match, the most specific one serves the request.
+// Requests with a known path but another method get 405, OPTIONS is answered with the allowed methods
+// and HEAD is served by the GET action unless it is unsafe.
 type Http struct {
-	actions []Action
+	routes      []route
+	middlewares []Middleware
+}
+
+type middlewareAction struct {
+	Action
+	middlewares []Middleware
+}
+
+// headResponseWriter drops the body of a GET response served for HEAD.
+type headResponseWriter struct {
+	http.ResponseWriter
 }
 
+type routeOrder int
+
+const (
+	routesDisjoint routeOrder = iota
+	routeMoreSpecific
+	routeLessSpecific
+	// routesConflict means both routes match some path and none of them is more specific
+	routesConflict
+)
+
+// NewHttp panics if two actions of the same method conflict, like http.ServeMux does,
+// since that is a mistake in the code rather than in the request.
 func NewHttp(actions ...Action) *Http {
-	return &Http{actions: actions}
+	h := &Http{routes: make([]route, len(actions))}
+	for i, action := range actions {
+		segments := getPathSegments(action.Route())
+		if i := slices.IndexFunc(segments, isWildcard); i >= 0 && i != len(segments)-1 {
+			panic(fmt.Sprintf("transport: %s %s: wildcard must be the last segment", action.Method(), action.Route()))
+		}
+
+		for _, other := range h.routes[:i] {
+			if other.action.Method() == action.Method() && compareRoutes(segments, other.segments) == routesConflict {
+				panic(fmt.Sprintf("transport: %s %s conflicts with %s", action.Method(), action.Route(), other.action.Route()))
+			}
+		}
+
+		h.routes[i] = route{action: action, segments: segments}
+	}
+
+	h.chain()
+
+	return h
+}
+
+// Use adds middlewares run for every matched action before its own ones, the first one is the outermost.
+// Requests no action matches skip them. Use must be called before serving.
+func (h *Http) Use(middlewares ...Middleware) *Http {
+	h.middlewares = append(h.middlewares, middlewares...)
+	h.chain()
+
+	return h
+}
+
+// WithMiddlewares gives the action middlewares of its own, run after the global ones.
+func WithMiddlewares(action Action, middlewares ...Middleware) Action {
+	return &middlewareAction{Action: action, middlewares: middlewares}
+}
+
+func (a *middlewareAction) Middlewares() []Middleware {
+	if inner, ok := a.Action.(ActionMiddlewares); ok {
+		return append(slices.Clone(a.middlewares), inner.Middlewares()...)
+	}
+
+	return a.middlewares
+}
+
+func (a *middlewareAction) IsUnsafe() bool {
+	return isUnsafe(a.Action)
 }
 
 func (h *Http) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	action, params, ok := h.findRouteHandler(r)
-	if !ok {
-		http.NotFound(w, r)
+	pathSegments := getPathSegments(r.URL.Path)
+
+	if route, params := h.findRoute(r.Method, pathSegments); route != nil {
+		route.handler(w, r, params)
 
 		return
 	}
 
-	action.Handle(w, r, params)
+	allowed := h.allowedMethods(pathSegments)
+
+	switch {
+	case len(allowed) == 0:
+		http.NotFound(w, r)
+	case r.Method == http.MethodHead && slices.Contains(allowed, http.MethodHead):
+		route, params := h.findRoute(http.MethodGet, pathSegments)
+		route.handler(headResponseWriter{w}, r, params)
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
 }
 
-func (h *Http) findRouteHandler(r *http.Request) (Action, Params, bool) {
-	if len(h.actions) == 0 {
-		return nil, nil, false
+func (h *Http) chain() {
+	for i := range h.routes {
+		middlewares := h.middlewares
+		if withMiddlewares, ok := h.routes[i].action.(ActionMiddlewares); ok {
+			middlewares = append(slices.Clone(middlewares), withMiddlewares.Middlewares()...)
+		}
+
+		handler := h.routes[i].action.Handle
+		for _, middleware := range slices.Backward(middlewares) {
+			handler = middleware(h.routes[i].action, handler)
+		}
+
+		h.routes[i].handler = handler
 	}
+}
 
-	pathSegments := getPathSegments(r.URL.Path)
+// findRoute returns the most specific route of the method matching the path or nil.
+// Routes matching the same path are never in conflict, so the most specific one is always there.
+func (h *Http) findRoute(method string, pathSegments []string) (*route, Params) {
+	var found *route
+	var foundParams Params
 
-	for _, action := range h.actions {
-		if r.Method != action.Method() {
+	for i := range h.routes {
+		if method != h.routes[i].action.Method() {
 			continue
 		}
 
-		actionPathSegments := getPathSegments(action.Route())
+		params, ok := matchPathSegments(h.routes[i].segments, pathSegments)
+		if !ok {
+			continue
+		}
 
-		if params, ok := matchPathSegments(actionPathSegments, pathSegments); ok {
-			return action, params, true
+		if found == nil || compareRoutes(h.routes[i].segments, found.segments) == routeMoreSpecific {
+			found, foundParams = &h.routes[i], params
 		}
 	}
 
-	return nil, nil, false
+	return found, foundParams
 }
 
-func matchPathSegments(actionPathSegments, requestPathSegments []string) (Params, bool) {
-	if len(actionPathSegments) != len(requestPathSegments) {
-		return nil, false
+// allowedMethods returns sorted methods of the routes matching the path, or nothing if there are none.
+func (h *Http) allowedMethods(pathSegments []string) []string {
+	var methods []string
+
+	for _, route := range h.routes {
+		if _, ok := matchPathSegments(route.segments, pathSegments); ok {
+			methods = append(methods, route.action.Method())
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil
+	}
+
+	if route, _ := h.findRoute(http.MethodGet, pathSegments); route != nil && !isUnsafe(route.action) {
+		methods = append(methods, http.MethodHead)
 	}
 
+	methods = append(methods, http.MethodOptions)
+	slices.Sort(methods)
+
+	return slices.Compact(methods)
+}
+
+func (w headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func isUnsafe(action Action) bool {
+	unsafeAction, ok := action.(UnsafeAction)
+
+	return ok && unsafeAction.IsUnsafe()
+}
+
+func matchPathSegments(actionPathSegments, requestPathSegments []string) (Params, bool) {
 	params := make(Params)
 
 	for i, actionPathSegment := range actionPathSegments {
+		if isWildcard(actionPathSegment) {
+			params[paramName(actionPathSegment)] = strings.Join(requestPathSegments[i:], "/")
+
+			return params, true
+		}
+
+		if i >= len(requestPathSegments) {
+			return nil, false
+		}
+
 		if isParam(actionPathSegment) {
-			key := strings.Trim(actionPathSegment, "{}")
-			params[key] = requestPathSegments[i]
+			params[paramName(actionPathSegment)] = requestPathSegments[i]
 
 			continue
 		}
@@ -74,13 +247,72 @@ func matchPathSegments(actionPathSegments, requestPathSegments []string) (Params
 		}
 	}
 
-	return params, true
+	return params, len(actionPathSegments) == len(requestPathSegments)
+}
+
+// compareRoutes tells whether route a matches a strict subset of paths of route b, or the other way round.
+// A literal segment is more specific than a param, and any segment is more specific than a wildcard.
+func compareRoutes(a, b []string) routeOrder {
+	isAMore, isBMore := false, false
+
+	for i := 0; ; i++ {
+		if i < len(a) && i < len(b) && isWildcard(a[i]) && isWildcard(b[i]) {
+			break
+		}
+
+		if i < len(a) && isWildcard(a[i]) {
+			isBMore = true
+
+			break
+		}
+
+		if i < len(b) && isWildcard(b[i]) {
+			isAMore = true
+
+			break
+		}
+
+		if i == len(a) || i == len(b) {
+			if len(a) != len(b) {
+				return routesDisjoint
+			}
+
+			break
+		}
+
+		switch {
+		case isParam(a[i]) && isParam(b[i]):
+		case isParam(b[i]):
+			isAMore = true
+		case isParam(a[i]):
+			isBMore = true
+		case a[i] != b[i]:
+			return routesDisjoint
+		}
+	}
+
+	switch {
+	case isAMore && !isBMore:
+		return routeMoreSpecific
+	case isBMore && !isAMore:
+		return routeLessSpecific
+	default:
+		return routesConflict
+	}
 }
 
 func isParam(pathSegment string) bool {
 	return strings.HasPrefix(pathSegment, "{") && strings.HasSuffix(pathSegment, "}")
 }
 
+func isWildcard(pathSegment string) bool {
+	return isParam(pathSegment) && strings.HasSuffix(pathSegment, "...}")
+}
+
+func paramName(pathSegment string) string {
+	return strings.TrimSuffix(strings.Trim(pathSegment, "{}"), "...")
+}
+
 func getPathSegments(path string) []string {
 	return strings.Split(strings.Trim(path, "/"), "/")
 }
@@ -0,0 +1,197 @@
+package transport_test
+
+import (
+	"go-test-task/internal/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testAction struct {
+	method      string
+	route       string
+	handle      func(w http.ResponseWriter, params transport.Params)
+	middlewares []transport.Middleware
+}
+
+func (a *testAction) Route() string {
+	return a.route
+}
+
+func (a *testAction) Method() string {
+	return a.method
+}
+
+func (a *testAction) Handle(w http.ResponseWriter, r *http.Request, params transport.Params) {
+	a.handle(w, params)
+}
+
+func (a *testAction) Middlewares() []transport.Middleware {
+	return a.middlewares
+}
+
+// trace appends its name to the X-Trace header before and after the next handler.
+func trace(name string) transport.Middleware {
+	return func(action transport.Action, next transport.Handler) transport.Handler {
+		return func(w http.ResponseWriter, r *http.Request, params transport.Params) {
+			w.Header().Add("X-Trace", name+">"+action.Route())
+			next(w, r, params)
+			w.Header().Add("X-Trace", "<"+name)
+		}
+	}
+}
+
+func Test_Http_MiddlewaresRunInOrder(t *testing.T) {
+	t.Parallel()
+
+	ok := func(w http.ResponseWriter, params transport.Params) {
+		w.Header().Add("X-Trace", "handle "+params["id"])
+	}
+
+	httpHandler := transport.NewHttp(
+		transport.WithMiddlewares(&testAction{
+			method:      http.MethodGet,
+			route:       "/item/{id}",
+			handle:      ok,
+			middlewares: []transport.Middleware{trace("own")},
+		}, trace("wrapped")),
+		&testAction{method: http.MethodGet, route: "/plain", handle: ok},
+	).Use(trace("first"), trace("second"))
+
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/item/7", nil))
+	assert.Equal(t, []string{
+		"first>/item/{id}", "second>/item/{id}", "wrapped>/item/{id}", "own>/item/{id}",
+		"handle 7",
+		"<own", "<wrapped", "<second", "<first",
+	}, resp.Header().Values("X-Trace"))
+
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	assert.Equal(t, []string{"first>/plain", "second>/plain", "handle ", "<second", "<first"}, resp.Header().Values("X-Trace"))
+
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Empty(t, resp.Header().Values("X-Trace"), "unmatched requests skip middlewares")
+}
+
+func Test_Http_RecoverRespondsWithInternalError(t *testing.T) {
+	t.Parallel()
+
+	httpHandler := transport.NewHttp(&testAction{
+		method: http.MethodGet,
+		route:  "/panic",
+		handle: func(http.ResponseWriter, transport.Params) { panic("boom") },
+	}).Use(transport.Recover)
+
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
+
+func Test_Http_MethodNotAllowedAndOptions(t *testing.T) {
+	t.Parallel()
+
+	write := func(body string) func(http.ResponseWriter, transport.Params) {
+		return func(w http.ResponseWriter, params transport.Params) {
+			w.Write([]byte(body))
+		}
+	}
+
+	httpHandler := transport.NewHttp(
+		&testAction{method: http.MethodGet, route: "/item/{id}", handle: write("item")},
+		&testAction{method: http.MethodPut, route: "/item/{id}", handle: write("put")},
+		&testAction{method: http.MethodGet, route: "/take/{id}", handle: write("taken")},
+		&unsafeAction{testAction{method: http.MethodGet, route: "/take/{id}/once", handle: write("taken")}},
+	)
+
+	resp := httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/item/1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT", resp.Header().Get("Allow"))
+
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodOptions, "/item/1", nil))
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT", resp.Header().Get("Allow"))
+
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodHead, "/item/1", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodHead, "/take/1/once", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code, "unsafe GET does not serve HEAD")
+	assert.Equal(t, "GET, OPTIONS", resp.Header().Get("Allow"))
+
+	resp = httptest.NewRecorder()
+	httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodOptions, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+type unsafeAction struct {
+	testAction
+}
+
+func (a *unsafeAction) IsUnsafe() bool {
+	return true
+}
+
+func Test_Http_MostSpecificRouteWins(t *testing.T) {
+	t.Parallel()
+
+	echo := func(name string) func(http.ResponseWriter, transport.Params) {
+		return func(w http.ResponseWriter, params transport.Params) {
+			w.Write([]byte(name + " " + params["id"] + params["path"]))
+		}
+	}
+
+	httpHandler := transport.NewHttp(
+		&testAction{method: http.MethodGet, route: "/files/{path...}", handle: echo("wildcard")},
+		&testAction{method: http.MethodGet, route: "/files/{id}", handle: echo("param")},
+		&testAction{method: http.MethodGet, route: "/files/readme", handle: echo("literal")},
+	)
+
+	for path, expected := range map[string]string{
+		"/files/readme":    "literal ",
+		"/files/7":         "param 7",
+		"/files/a/b/c.txt": "wildcard a/b/c.txt",
+		"/files":           "wildcard ",
+	} {
+		resp := httptest.NewRecorder()
+		httpHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, expected, resp.Body.String(), path)
+	}
+}
+
+func Test_Http_ConflictingRoutesPanic(t *testing.T) {
+	t.Parallel()
+
+	for _, routes := range [][2]string{
+		{"/queue/{name}", "/queue/{id}"},
+		{"/queue/{name}/stats", "/queue/stats/{name}"},
+		{"/files/{path...}", "/files/{rest...}"},
+	} {
+		assert.Panics(t, func() {
+			transport.NewHttp(
+				&testAction{method: http.MethodGet, route: routes[0]},
+				&testAction{method: http.MethodGet, route: routes[1]},
+			)
+		}, routes)
+	}
+
+	assert.NotPanics(t, func() {
+		transport.NewHttp(
+			&testAction{method: http.MethodGet, route: "/queue/{name}"},
+			&testAction{method: http.MethodPut, route: "/queue/{name}"},
+		)
+	})
+
+	assert.Panics(t, func() {
+		transport.NewHttp(&testAction{method: http.MethodGet, route: "/files/{path...}/meta"})
+	}, "wildcard in the middle")
+}
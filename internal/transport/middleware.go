@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover turns a panic of the handler into 500, so the client gets a response instead of a dropped connection.
+func Recover(action Action, next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request, params Params) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			// The handler aborted the response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("%s %s: panic: %v\n%s", action.Method(), action.Route(), err, debug.Stack())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next(w, r, params)
+	}
+}
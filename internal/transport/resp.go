@@ -0,0 +1,326 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrRespProtocol = errors.New("protocol error")
+
+// defaultMaxRespArgSize limits bulk strings when no limit is given, like messages of WebSockets.
+const defaultMaxRespArgSize = defaultMaxWebSocketMessageSize
+
+// maxRespArgsPrealloc bounds the capacity taken for arguments before they are read.
+const maxRespArgsPrealloc = 64
+
+// maxRespArgs bounds the number of arguments of a command, like Redis does.
+const maxRespArgs = 1024 * 1024
+
+// RespCommand is a command of the Redis serialization protocol. Handle writes exactly one reply,
+// args include the command name.
+type RespCommand interface {
+	Name() string
+	Handle(w *RespWriter, args [][]byte, ctx context.Context)
+}
+
+// Resp serves commands of the Redis serialization protocol, RESP2. Commands of a connection
+// are handled in order, the ctx of a command is done when the client disconnects.
+type Resp struct {
+	commands map[string]RespCommand
+	// maxArgSize limits bulk strings of commands, zero takes defaultMaxRespArgSize.
+	maxArgSize int64
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	isClosed bool
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+func NewResp(maxArgSize int64, commands ...RespCommand) *Resp {
+	if maxArgSize <= 0 {
+		maxArgSize = defaultMaxRespArgSize
+	}
+
+	r := &Resp{
+		commands:   make(map[string]RespCommand, len(commands)),
+		maxArgSize: maxArgSize,
+		conns:      make(map[net.Conn]struct{}),
+	}
+
+	for _, command := range commands {
+		name := strings.ToUpper(command.Name())
+		if _, isExist := r.commands[name]; isExist {
+			panic(fmt.Sprintf("transport: command %s is registered twice", name))
+		}
+
+		r.commands[name] = command
+	}
+
+	return r
+}
+
+// Serve accepts connections until Close, then it returns nil.
+func (r *Resp) Serve(listener net.Listener) error {
+	r.mu.Lock()
+	if r.isClosed {
+		r.mu.Unlock()
+		listener.Close()
+
+		return nil
+	}
+
+	r.listener = listener
+	r.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			r.mu.Lock()
+			isClosed := r.isClosed
+			r.mu.Unlock()
+
+			if isClosed {
+				return nil
+			}
+
+			return err
+		}
+
+		if !r.track(conn) {
+			conn.Close()
+
+			return nil
+		}
+
+		go func() {
+			defer r.untrack(conn)
+			r.serveConn(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for their commands to end.
+func (r *Resp) Close() error {
+	r.mu.Lock()
+	r.isClosed = true
+
+	var err error
+	if r.listener != nil {
+		err = r.listener.Close()
+	}
+
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	return err
+}
+
+func (r *Resp) track(conn net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isClosed {
+		return false
+	}
+
+	r.conns[conn] = struct{}{}
+	r.wg.Add(1)
+
+	return true
+}
+
+func (r *Resp) untrack(conn net.Conn) {
+	r.mu.Lock()
+	delete(r.conns, conn)
+	r.mu.Unlock()
+
+	conn.Close()
+	r.wg.Done()
+}
+
+// serveConn reads commands in a goroutine of its own, so a disconnect is seen while a command blocks.
+func (r *Resp) serveConn(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	commands := make(chan [][]byte)
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(commands)
+		defer cancel()
+
+		reader := bufio.NewReader(conn)
+
+		for {
+			args, err := readRespCommand(reader, r.maxArgSize)
+			if err != nil {
+				readErr <- err
+
+				return
+			}
+
+			if len(args) == 0 {
+				continue
+			}
+
+			select {
+			case commands <- args:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	w := &RespWriter{w: bufio.NewWriter(conn)}
+
+	for args := range commands {
+		r.handle(w, args, ctx)
+
+		if err := w.w.Flush(); err != nil {
+			return
+		}
+	}
+
+	if err := <-readErr; errors.Is(err, ErrRespProtocol) {
+		w.WriteError(err.Error())
+		w.w.Flush()
+	}
+}
+
+func (r *Resp) handle(w *RespWriter, args [][]byte, ctx context.Context) {
+	command, isExist := r.commands[strings.ToUpper(string(args[0]))]
+	if !isExist {
+		w.WriteError(fmt.Sprintf("unknown command '%s'", args[0]))
+
+		return
+	}
+
+	command.Handle(w, args, ctx)
+}
+
+// readRespCommand reads an array of bulk strings, or an inline command as telnet sends it.
+func readRespCommand(reader *bufio.Reader, maxArgSize int64) ([][]byte, error) {
+	line, err := readRespLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		fields := bytes.Fields(line)
+		args := make([][]byte, len(fields))
+
+		for i, field := range fields {
+			args[i] = bytes.Clone(field)
+		}
+
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxRespArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", ErrRespProtocol)
+	}
+
+	args := make([][]byte, 0, min(max(n, 0), maxRespArgsPrealloc))
+
+	for range n {
+		line, err := readRespLine(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$'", ErrRespProtocol)
+		}
+
+		size, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || size < 0 || size > maxArgSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", ErrRespProtocol)
+		}
+
+		// The buffer grows as the bytes come, not by the size the client claims
+		var arg bytes.Buffer
+		if _, err := io.CopyN(&arg, reader, size+2); err != nil {
+			return nil, err
+		}
+
+		if !bytes.HasSuffix(arg.Bytes(), []byte("\r\n")) {
+			return nil, fmt.Errorf("%w: bulk string without CRLF", ErrRespProtocol)
+		}
+
+		args = append(args, arg.Bytes()[:size])
+	}
+
+	return args, nil
+}
+
+// readRespLine reads a line without its CRLF. A line longer than the buffer of the reader is a protocol error.
+func readRespLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: too big inline request", ErrRespProtocol)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+}
+
+// RespWriter writes replies of a connection, they are flushed after each command.
+type RespWriter struct {
+	w *bufio.Writer
+}
+
+func (w *RespWriter) WriteSimpleString(s string) {
+	w.w.WriteString("+" + s + "\r\n")
+}
+
+// WriteError writes an error of the generic ERR kind, line breaks of the message are replaced.
+func (w *RespWriter) WriteError(message string) {
+	w.w.WriteString("-ERR " + strings.NewReplacer("\r", " ", "\n", " ").Replace(message) + "\r\n")
+}
+
+func (w *RespWriter) WriteInteger(n int) {
+	w.w.WriteString(":" + strconv.Itoa(n) + "\r\n")
+}
+
+func (w *RespWriter) WriteBulk(b []byte) {
+	w.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// WriteNull writes the null bulk string, the reply for a missing value.
+func (w *RespWriter) WriteNull() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// WriteArray writes an array of bulk strings.
+func (w *RespWriter) WriteArray(values ...[]byte) {
+	w.w.WriteString("*" + strconv.Itoa(len(values)) + "\r\n")
+
+	for _, value := range values {
+		w.WriteBulk(value)
+	}
+}
+
+// WriteNullArray writes the null array, the reply of a blocking command that timed out.
+func (w *RespWriter) WriteNullArray() {
+	w.w.WriteString("*-1\r\n")
+}
@@ -0,0 +1,134 @@
+package transport_test
+
+import (
+	"bufio"
+	"context"
+	"go-test-task/internal/transport"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockCommand struct {
+	started chan struct{}
+}
+
+func (c *blockCommand) Name() string {
+	return "block"
+}
+
+func (c *blockCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	close(c.started)
+	<-ctx.Done()
+	w.WriteSimpleString("UNBLOCKED")
+}
+
+type echoCommand struct{}
+
+func (c echoCommand) Name() string {
+	return "echo"
+}
+
+func (c echoCommand) Handle(w *transport.RespWriter, args [][]byte, ctx context.Context) {
+	w.WriteBulk(args[1])
+}
+
+func serveResp(t *testing.T, server *transport.Resp) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return listener.Addr().String()
+}
+
+func dialResp(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	return conn, bufio.NewReader(conn)
+}
+
+func Test_Resp_CloseEndsBlockedCommands(t *testing.T) {
+	t.Parallel()
+
+	command := &blockCommand{started: make(chan struct{})}
+	server := transport.NewResp(0, command)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = conn.Write([]byte("*1\r\n$5\r\nBLOCK\r\n"))
+	require.NoError(t, err)
+	<-command.started
+
+	require.NoError(t, server.Close())
+	assert.NoError(t, <-served)
+
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	assert.Error(t, err, "the connection is closed")
+
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err)
+}
+
+func Test_Resp_RejectsCommandsRegisteredTwice(t *testing.T) {
+	t.Parallel()
+
+	assert.Panics(t, func() {
+		transport.NewResp(0, &blockCommand{}, &blockCommand{})
+	})
+}
+
+func Test_Resp_LimitsBulkStringsBeforeReadingThem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default limit", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reader := dialResp(t, serveResp(t, transport.NewResp(0, echoCommand{})))
+
+		_, err := conn.Write([]byte("*2\r\n$4\r\nECHO\r\n$536870000\r\n"))
+		require.NoError(t, err)
+
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "-ERR protocol error: invalid bulk length\r\n", line)
+	})
+
+	t.Run("claimed length", func(t *testing.T) {
+		t.Parallel()
+
+		addr := serveResp(t, transport.NewResp(1<<40, echoCommand{}))
+
+		conn, _ := dialResp(t, addr)
+		_, err := conn.Write([]byte("*2\r\n$4\r\nECHO\r\n$549755813888\r\nabc"))
+		require.NoError(t, err)
+		conn.Close()
+
+		conn, reader := dialResp(t, addr)
+		_, err = conn.Write([]byte("*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n"))
+		require.NoError(t, err)
+
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "$2\r\n", line)
+	})
+}
@@ -0,0 +1,12 @@
+package transport
+
+import "net/http"
+
+// retryAfter is the number of seconds a client should wait before retrying a request the server could not serve now.
+const retryAfter = "1"
+
+// WriteRetryableError responds with 503, so clients retry the request, e.g. on another instance.
+func WriteRetryableError(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", retryAfter)
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
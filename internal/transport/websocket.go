@@ -0,0 +1,312 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var ErrWebSocketClosed = errors.New("websocket closed")
+var ErrWebSocketProtocol = errors.New("websocket protocol error")
+var ErrWebSocketMessageTooLarge = errors.New("websocket message too large")
+
+// Opcodes of RFC 6455 frames.
+const (
+	OpText   byte = 0x1
+	OpBinary byte = 0x2
+
+	opContinuation byte = 0x0
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xA
+)
+
+// Close codes of RFC 6455.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseInvalidPayload  = 1007
+	CloseMessageTooLarge = 1009
+	CloseInternalError   = 1011
+)
+
+// webSocketGUID is appended to the client key to compute the accept key.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxControlPayload is the limit of RFC 6455 for ping, pong and close frames.
+const maxControlPayload = 125
+
+// defaultMaxWebSocketMessageSize limits messages when no limit is given, so a client can't make the server
+// allocate whatever a frame header claims.
+const defaultMaxWebSocketMessageSize = 32 << 20
+
+// WebSocket is a server side RFC 6455 connection. ReadMessage must be called from one goroutine,
+// writes may come from any.
+type WebSocket struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	// maxMessageSize limits messages put together from frames.
+	maxMessageSize int64
+	writeMu        sync.Mutex
+	isClosed       bool
+}
+
+// UpgradeWebSocket answers the opening handshake and takes over the connection.
+// On a handshake error it responds with 400 or 426 itself. Zero maxMessageSize takes the default limit.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request, maxMessageSize int64) (*WebSocket, error) {
+	const op = "UpgradeWebSocket"
+
+	if r.Method != http.MethodGet ||
+		!hasToken(r.Header, "Connection", "upgrade") ||
+		!hasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+
+		return nil, fmt.Errorf("%s: %w: not an upgrade request", op, ErrWebSocketProtocol)
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+
+		return nil, fmt.Errorf("%s: %w: unsupported version", op, ErrWebSocketProtocol)
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid websocket key", http.StatusBadRequest)
+
+		return nil, fmt.Errorf("%s: %w: invalid key", op, ErrWebSocketProtocol)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accept := sha1.Sum([]byte(key + webSocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n")
+
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultMaxWebSocketMessageSize
+	}
+
+	return &WebSocket{conn: conn, rw: rw, maxMessageSize: maxMessageSize}, nil
+}
+
+// ReadMessage returns the next text or binary message put together from its frames.
+// It answers pings and the closing handshake, after which it returns ErrWebSocketClosed.
+func (ws *WebSocket) ReadMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+
+	for {
+		fin, frameOpcode, payload, err := ws.readFrame(ws.maxMessageSize - int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, ws.answerClose(payload)
+		case opContinuation:
+			if opcode == 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		case OpText, OpBinary:
+			if opcode != 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "expected continuation frame")
+			}
+
+			opcode = frameOpcode
+		default:
+			return 0, nil, ws.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		message = append(message, payload...)
+
+		if !fin {
+			continue
+		}
+
+		if opcode == OpText && !utf8.Valid(message) {
+			return 0, nil, ws.fail(CloseInvalidPayload, "invalid utf-8")
+		}
+
+		return opcode, message, nil
+	}
+}
+
+// WriteMessage sends the message in one frame.
+func (ws *WebSocket) WriteMessage(opcode byte, data []byte) error {
+	return ws.writeFrame(opcode, data)
+}
+
+// Close starts the closing handshake and closes the connection without waiting for the answer.
+func (ws *WebSocket) Close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason[:min(len(reason), maxControlPayload-2)]...)
+
+	err := ws.writeFrame(opClose, payload)
+
+	ws.writeMu.Lock()
+	ws.isClosed = true
+	ws.writeMu.Unlock()
+
+	if closeErr := ws.conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// readFrame reads a client frame, those must be masked. A data frame longer than maxLength,
+// what is left of the message limit, is not read at all.
+func (ws *WebSocket) readFrame(maxLength int64) (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	isMasked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, ws.fail(CloseProtocolError, "reserved bits set")
+	}
+
+	if !isMasked {
+		return false, 0, nil, ws.fail(CloseProtocolError, "unmasked client frame")
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.rw, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.rw, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if opcode >= opClose && (!fin || length > maxControlPayload) {
+		return false, 0, nil, ws.fail(CloseProtocolError, "invalid control frame")
+	}
+
+	if opcode < opClose && length > uint64(maxLength) {
+		ws.Close(CloseMessageTooLarge, "message too large")
+
+		return false, 0, nil, ErrWebSocketMessageTooLarge
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends an unmasked final frame, as servers do.
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.isClosed {
+		return ErrWebSocketClosed
+	}
+
+	header := []byte{0x80 | opcode}
+
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = binary.BigEndian.AppendUint16(append(header, 126), uint16(length))
+	default:
+		header = binary.BigEndian.AppendUint64(append(header, 127), uint64(length))
+	}
+
+	ws.rw.Write(header)
+	ws.rw.Write(payload)
+
+	return ws.rw.Flush()
+}
+
+// answerClose echoes the close code of the client and closes the connection.
+func (ws *WebSocket) answerClose(payload []byte) error {
+	code := CloseNormal
+	if len(payload) >= 2 {
+		code = int(binary.BigEndian.Uint16(payload))
+	}
+
+	ws.Close(code, "")
+
+	return ErrWebSocketClosed
+}
+
+func (ws *WebSocket) fail(code int, reason string) error {
+	ws.Close(code, reason)
+
+	return fmt.Errorf("%w: %s", ErrWebSocketProtocol, reason)
+}
+
+// hasToken tells a comma-separated header has the token, in any case.
+func hasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,239 @@
+package transport_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"go-test-task/internal/transport"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echoes messages back until the client closes, then reports the read error.
+func echoServer(t *testing.T, maxMessageSize int64) (string, <-chan error) {
+	t.Helper()
+
+	done := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := transport.UpgradeWebSocket(w, r, maxMessageSize)
+		if err != nil {
+			done <- err
+
+			return
+		}
+
+		for {
+			opcode, data, err := ws.ReadMessage()
+			if err != nil {
+				done <- err
+
+				return
+			}
+
+			ws.WriteMessage(opcode, data)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://"), done
+}
+
+func dialWebSocket(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: " + addr + "\r\n" +
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	// The sample key and accept value of RFC 6455
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	return conn, reader
+}
+
+func writeFrame(t *testing.T, conn net.Conn, fin bool, opcode byte, payload []byte, isMasked bool) {
+	t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+
+	frame := []byte{first}
+	maskBit := byte(0)
+	if isMasked {
+		maskBit = 0x80
+	}
+
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	default:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(len(payload)))
+	}
+
+	if isMasked {
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	_, err := io.ReadFull(reader, header[:])
+	require.NoError(t, err)
+
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		_, err := io.ReadFull(reader, extended[:])
+		require.NoError(t, err)
+
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+
+	return header[0] & 0x0F, payload
+}
+
+func Test_WebSocket_EchoesFragmentedMessagesAndAnswersPings(t *testing.T) {
+	t.Parallel()
+
+	addr, done := echoServer(t, 0)
+	conn, reader := dialWebSocket(t, addr)
+
+	writeFrame(t, conn, false, transport.OpText, []byte("hello, "), true)
+	writeFrame(t, conn, true, 0x9, []byte("ping"), true)
+	writeFrame(t, conn, true, 0x0, []byte(strings.Repeat("w", 200)), true)
+
+	opcode, payload := readFrame(t, reader)
+	assert.Equal(t, byte(0xA), opcode, "pong comes between fragments")
+	assert.Equal(t, "ping", string(payload))
+
+	opcode, payload = readFrame(t, reader)
+	assert.Equal(t, transport.OpText, opcode)
+	assert.Equal(t, "hello, "+strings.Repeat("w", 200), string(payload))
+
+	writeFrame(t, conn, true, 0x8, binary.BigEndian.AppendUint16(nil, transport.CloseNormal), true)
+
+	opcode, payload = readFrame(t, reader)
+	assert.Equal(t, byte(0x8), opcode)
+	assert.Equal(t, uint16(transport.CloseNormal), binary.BigEndian.Uint16(payload))
+	assert.ErrorIs(t, <-done, transport.ErrWebSocketClosed)
+}
+
+func Test_WebSocket_RejectsBadFrames(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		opcode   byte
+		payload  []byte
+		isMasked bool
+		code     uint16
+		expected error
+	}{
+		"unmasked": {
+			opcode: transport.OpText, payload: []byte("hi"), isMasked: false,
+			code: transport.CloseProtocolError, expected: transport.ErrWebSocketProtocol,
+		},
+		"too large": {
+			opcode: transport.OpBinary, payload: make([]byte, 17), isMasked: true,
+			code: transport.CloseMessageTooLarge, expected: transport.ErrWebSocketMessageTooLarge,
+		},
+		"invalid utf-8": {
+			opcode: transport.OpText, payload: []byte{0xff}, isMasked: true,
+			code: transport.CloseInvalidPayload, expected: transport.ErrWebSocketProtocol,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			addr, done := echoServer(t, 16)
+			conn, reader := dialWebSocket(t, addr)
+
+			writeFrame(t, conn, true, test.opcode, test.payload, test.isMasked)
+
+			opcode, payload := readFrame(t, reader)
+			assert.Equal(t, byte(0x8), opcode)
+			assert.Equal(t, test.code, binary.BigEndian.Uint16(payload))
+			assert.ErrorIs(t, <-done, test.expected)
+		})
+	}
+}
+
+func Test_WebSocket_RequiresUpgrade(t *testing.T) {
+	t.Parallel()
+
+	addr, done := echoServer(t, 0)
+
+	resp, err := http.Get("http://" + addr)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	assert.ErrorIs(t, <-done, transport.ErrWebSocketProtocol)
+}
+
+func Test_WebSocket_LimitsMessagesBeforeReadingThem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("frame header of the default limit", func(t *testing.T) {
+		t.Parallel()
+
+		addr, done := echoServer(t, 0)
+		conn, reader := dialWebSocket(t, addr)
+
+		header := binary.BigEndian.AppendUint64([]byte{0x82, 0x80 | 127}, 1<<40)
+		_, err := conn.Write(append(header, 1, 2, 3, 4))
+		require.NoError(t, err)
+
+		opcode, payload := readFrame(t, reader)
+		assert.Equal(t, byte(0x8), opcode)
+		assert.Equal(t, uint16(transport.CloseMessageTooLarge), binary.BigEndian.Uint16(payload))
+		assert.ErrorIs(t, <-done, transport.ErrWebSocketMessageTooLarge)
+	})
+
+	t.Run("fragments", func(t *testing.T) {
+		t.Parallel()
+
+		addr, done := echoServer(t, 16)
+		conn, reader := dialWebSocket(t, addr)
+
+		writeFrame(t, conn, false, transport.OpBinary, make([]byte, 10), true)
+		writeFrame(t, conn, true, 0x0, make([]byte, 10), true)
+
+		opcode, payload := readFrame(t, reader)
+		assert.Equal(t, byte(0x8), opcode)
+		assert.Equal(t, uint16(transport.CloseMessageTooLarge), binary.BigEndian.Uint16(payload))
+		assert.ErrorIs(t, <-done, transport.ErrWebSocketMessageTooLarge)
+	})
+}